@@ -2,4 +2,6 @@ module devsnap
 
 go 1.24.5
 
+require gopkg.in/yaml.v3 v3.0.1
+
 require github.com/joho/godotenv v1.5.1 // indirect
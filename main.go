@@ -3,14 +3,19 @@ package main
 import (
 	"archive/tar"
 	"compress/gzip"
+	"context"
+	"devsnap/pkg/config"
 	"devsnap/pkg/create"
+	"devsnap/pkg/devpack"
 	"devsnap/pkg/metadata"
 	"devsnap/pkg/start"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 	"time"
@@ -31,6 +36,18 @@ func main() {
 		handleStart(os.Args[2:])
 	case "inspect":
 		handleInspect(os.Args[2:])
+	case "materialize":
+		handleMaterialize(os.Args[2:])
+	case "ps":
+		handlePs()
+	case "logs":
+		handleLogs(os.Args[2:])
+	case "stop":
+		handleStop(os.Args[2:])
+	case "sandbox":
+		handleSandbox(os.Args[2:])
+	case "restore":
+		handleRestore(os.Args[2:])
 	case "help":
 		printHelp()
 	default:
@@ -46,68 +63,204 @@ func printHelp() {
 	fmt.Println("  devsnap <command> [arguments]")
 	fmt.Println("\nCommands:")
 	fmt.Println("  create   Scan current execution and create a .devsnap archive")
+	fmt.Println("           --interactive, -i  Review detected settings before packing")
+	fmt.Println("           --offline          Never run npm/pip/go to find versions")
+	fmt.Println("           --from-sandbox [sandbox]  Snapshot a sandbox's current state, linked to its snapshot")
 	fmt.Println("  start    Unpack and run a .devsnap snapshot")
+	fmt.Println("           --detach, -d  Run the services in the background")
+	fmt.Println("           --name <name> Use a named sandbox (default: one per snapshot version)")
+	fmt.Println("           --dir <path>  Unpack to this directory instead")
+	fmt.Println("           --fresh       Rebuild the sandbox instead of reusing unpacked files and installs")
+	fmt.Println("  sandbox list|rm|prune  Manage the sandboxes snapshots are unpacked to")
+	fmt.Println("  sandbox diff [sandbox]  Show what changed in a sandbox since it was unpacked")
+	fmt.Println("  sandbox export-patch [sandbox]  Write those changes as a git patch (-o file, - for stdout)")
+	fmt.Println("  ps       List detached services of every sandbox")
+	fmt.Println("  logs [-f] [service]  Print (and follow) the output of a detached service")
+	fmt.Println("  stop [service]  Stop detached services (--timeout 10s before killing)")
+	fmt.Println("  restore <snapshot> [dir]  Apply a snapshot's files onto an existing checkout")
+	fmt.Println("           --dry-run     Only list what would change")
+	fmt.Println("           --overwrite   Take the snapshot's version of conflicting files")
+	fmt.Println("           --merge       Merge conflicting files three-way (needs the snapshot's git commit)")
 	fmt.Println("  inspect  View metadata of a .devsnap snapshot")
+	fmt.Println("  materialize [sandbox|dir]  Write package.json / requirements.txt / go.mod from the devpacks")
+	fmt.Println("           --force, -f  Overwrite existing manifests")
 	fmt.Println("  help     Show this help message")
 }
 
 func handleCreate(args []string) {
+	interactive, fromSandbox := false, false
+	sandbox := ""
+	var opts create.Options
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--interactive", "-i":
+			interactive = true
+		case "--offline":
+			opts.Offline = true
+		case "--from-sandbox":
+			fromSandbox = true
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				sandbox = args[i+1]
+				i++
+			}
+		}
+	}
+
 	wd, err := os.Getwd()
 	if err != nil {
 		fmt.Printf("Error getting working directory: %v\n", err)
 		os.Exit(1)
 	}
 
+	// Re-snapshotting a sandbox packs its current state, linked to the snapshot it came from
+	var parent *metadata.ParentSnapshot
+	var provenance *metadata.GitProvenance
+	var sandboxInfo *start.SandboxInfo
+	if fromSandbox {
+		wd = pickSandbox(sandbox)
+		sandboxInfo = mustReadSandboxInfo(wd)
+		var parentMeta metadata.SnapshotMetadata
+		if content, err := ioutil.ReadFile(filepath.Join(wd, "metadata.json")); err == nil {
+			json.Unmarshal(content, &parentMeta)
+		}
+		parent = &metadata.ParentSnapshot{Name: sandboxInfo.Snapshot, ID: sandboxInfo.SnapshotID, CreatedAt: parentMeta.CreatedAt}
+
+		// The sandbox isn't a checkout: it is the parent's commit plus the sandbox edits
+		if provenance = parentMeta.Git; provenance != nil {
+			provenance.Dirty = true
+		}
+	} else {
+		provenance = create.GitProvenance(wd)
+	}
+
 	fmt.Printf("📸 Snapping %s...\n", wd)
 
-	// 1. Scan Files
+	// 0. Project config (devsnap.json / devsnap.yaml)
+	cfg, err := config.Load(wd)
+	if err != nil {
+		fmt.Printf("Error loading project config: %v\n", err)
+		os.Exit(1)
+	}
+	if cfg != nil {
+		fmt.Printf("   • Using project config %s\n", cfg.FileName())
+	}
+
+	// 1. Scan & analyze files in one pass (Ctrl+C stops it)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	fmt.Print("   • Scanning... ")
-	files, err := create.ScanDirectory(wd)
+	analysis, err := create.ScanProject(ctx, wd, cfg)
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("Cancelled.")
+		os.Exit(130)
+	}
 	if err != nil {
 		fmt.Printf("Failed: %v\n", err)
 		os.Exit(1)
 	}
+	files := analysis.Files
+	if parent != nil {
+		// The parent's metadata.json was unpacked next to the project files
+		var kept []string
+		for _, f := range files {
+			if f != filepath.Join(wd, "metadata.json") {
+				kept = append(kept, f)
+			}
+		}
+		files = kept
+	}
 	fmt.Printf("Found %d files.\n", len(files))
 
 	// 2. Detect Project Type
 	fmt.Print("   • Detecting... ")
-	envs, cmds, name, reqVars := create.DetectProject(wd)
+	project := create.DetectProject(analysis, cfg, opts)
+	if parent != nil {
+		project.Name = parent.Name // Not the sandbox directory
+	}
 
 	envSummary := ""
-	for i, e := range envs {
+	for i, e := range project.Environments {
 		if i > 0 {
 			envSummary += ", "
 		}
 		envSummary += fmt.Sprintf("%s (%s)", e.Type, e.Version)
+		if e.Dir != "" {
+			envSummary += " in " + e.Dir
+		}
 	}
-	fmt.Printf("Detected %s [%s].\n", name, envSummary)
+	fmt.Printf("Detected %s [%s].\n", project.Name, envSummary)
 
-	if len(reqVars) > 0 {
-		fmt.Printf("   🔐 Detected %d required secrets (e.g. %s)\n", len(reqVars), reqVars[0])
+	if len(project.RequiredVars) > 0 {
+		fmt.Printf("   🔐 Detected %d required secrets (e.g. %s)\n", len(project.RequiredVars), project.RequiredVars[0])
 	}
 
-	// Check for ANY devpack files generated by Sherlock
-	filepath.Walk(wd, func(path string, info os.FileInfo, err error) error {
-		if !info.IsDir() && strings.HasSuffix(info.Name(), ".devpack") {
-			files = append(files, path)
+	// 3. Interactive review (answers are saved to the project config)
+	if interactive {
+		if cfg == nil {
+			cfg = &config.ProjectConfig{}
+		}
+		review := create.Review(wd, project.Environments, project.RequiredVars, cfg.Exclude, files)
+		project.Environments, project.RequiredVars = review.Environments, review.RequiredVars
+		if len(project.Environments) == 0 {
+			project.Environments = append(project.Environments, metadata.EnvironmentConfig{Type: "generic"})
 		}
-		return nil
-	})
 
-	// 3. Metadata
+		// The reviewed list is complete, so the next create must not re-add what was removed
+		cfg.Detection = config.DetectionReplace
+		cfg.Environments, cfg.RequiredVars, cfg.Exclude = review.Environments, review.RequiredVars, review.Exclude
+		if review.Save {
+			if err := config.Save(wd, cfg); err != nil {
+				fmt.Printf("   ⚠️  Could not save %s: %v\n", cfg.FileName(), err)
+			} else {
+				fmt.Printf("   💾 Saved answers to %s\n", cfg.FileName())
+			}
+		}
+
+		var kept []string
+		for _, f := range files {
+			rel, err := filepath.Rel(wd, f)
+			if err != nil || !cfg.Excludes(rel) {
+				kept = append(kept, f)
+			}
+		}
+		files = kept
+	}
+
+	// 4. Metadata
 	meta := metadata.SnapshotMetadata{
 		SchemaVersion: "1.0",
-		Name:          name,
+		Name:          project.Name,
+		Description:   project.Description,
+		Author:        project.Author,
+		Tags:          project.Tags,
 		CreatedAt:     time.Now().Format(time.RFC3339),
-		Environments:  envs,
-		Commands:      cmds,
-		RequiredVars:  reqVars,
+		Parent:        parent,
+		Git:           provenance,
+		Environments:  project.Environments,
+		Commands:      project.Commands,
+		RequiredVars:  project.RequiredVars,
+		Variables:     project.Variables,
 	}
 
-	// 4. Archive
-	outputName := fmt.Sprintf("%s.devsnap", name)
+	// 5. Archive (devpacks are generated entries, the project tree is left untouched)
+	generated, err := project.GeneratedFiles()
+	if err != nil {
+		fmt.Printf("Error generating devpacks: %v\n", err)
+		os.Exit(1)
+	}
+	outputName := fmt.Sprintf("%s.devsnap", project.Name)
+	if parent != nil {
+		// Written to where create was run, next to (never over) the parent snapshot
+		for n := 2; ; n++ {
+			if abs, _ := filepath.Abs(outputName); abs != sandboxInfo.SnapshotPath {
+				break
+			}
+			outputName = fmt.Sprintf("%s-%d.devsnap", project.Name, n)
+		}
+	}
 	fmt.Printf("   • Packing... ")
-	err = create.CreateArchive(wd, files, meta, outputName)
+	err = create.CreateArchive(wd, files, generated, meta, outputName)
 	if err != nil {
 		fmt.Printf("Failed: %v\n", err)
 		os.Exit(1)
@@ -118,45 +271,517 @@ func handleCreate(args []string) {
 }
 
 func handleStart(args []string) {
-	if len(args) < 1 {
-		fmt.Println("Usage: devsnap start <snapshot-file> [--manual|-m]")
+	usage := "Usage: devsnap start <snapshot-file> [--manual|-m] [--detach|-d] [--fresh] [--name <name> | --dir <path>]"
+	var snapshotFile, name, dir string
+	fresh := false
+	opts := start.Options{}
+
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--manual", "-m":
+			opts.Manual = true
+		case "--detach", "-d":
+			opts.Detach = true
+		case "--fresh":
+			fresh = true
+		case "--name", "--dir":
+			if i+1 >= len(args) {
+				fmt.Printf("Error: %s needs a value\n", args[i])
+				os.Exit(1)
+			}
+			if args[i] == "--name" {
+				name = args[i+1]
+			} else {
+				dir = args[i+1]
+			}
+			i++
+		default:
+			snapshotFile = args[i]
+		}
+	}
+
+	if snapshotFile == "" {
+		fmt.Println(usage)
 		os.Exit(1)
 	}
 
-	var snapshotFile string
-	manualMode := false
+	if err := startSnapshot(snapshotFile, name, dir, fresh, opts); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
 
-	for _, arg := range args {
-		if arg == "--manual" || arg == "-m" {
-			manualMode = true
-		} else {
-			snapshotFile = arg
+// startSnapshot unpacks a snapshot into its sandbox and runs it, holding the sandbox lock throughout.
+// A sandbox already holding the same snapshot is reused as is, unless fresh.
+func startSnapshot(snapshotFile, name, dir string, fresh bool, opts start.Options) error {
+	snapshotID, err := start.SnapshotID(snapshotFile)
+	if err != nil {
+		return fmt.Errorf("reading snapshot: %w", err)
+	}
+	opts.SnapshotID = snapshotID
+	meta, err := start.ReadMetadata(snapshotFile)
+	if err != nil {
+		return fmt.Errorf("reading snapshot: %w", err)
+	}
+
+	// 1. Pick the sandbox: --dir, else the named one, else one per snapshot version
+	sandboxDir := dir
+	if sandboxDir == "" {
+		if sandboxDir, err = start.SandboxDir(name, meta.Name, snapshotID); err != nil {
+			return err
 		}
 	}
 
-	if snapshotFile == "" {
-		fmt.Println("Usage: devsnap start <snapshot-file> [--manual|-m]")
+	release, err := start.LockSandbox(sandboxDir)
+	if err != nil {
+		return fmt.Errorf("%s: %w", sandboxDir, err)
+	}
+	defer release()
+
+	// Detached services still write to the sandbox
+	if start.HasRunning(sandboxDir) {
+		return fmt.Errorf("services are still running in %s. Run 'devsnap stop --sandbox %s' first", sandboxDir, sandboxDir)
+	}
+
+	// A directory that isn't a sandbox is never emptied
+	info, err := start.ReadSandboxInfo(sandboxDir)
+	if err != nil {
+		return fmt.Errorf("checking sandbox: %w", err)
+	}
+	if entries, _ := ioutil.ReadDir(sandboxDir); len(entries) > 0 && info == nil {
+		return fmt.Errorf("%s is not empty and isn't a devsnap sandbox", sandboxDir)
+	}
+
+	changes, err := start.SandboxChanges(sandboxDir)
+	if err != nil {
+		return fmt.Errorf("checking sandbox: %w", err)
+	}
+
+	if info != nil && info.SnapshotID == snapshotID && !fresh {
+		// 2a. Warm start: the sandbox already holds this snapshot, edits included
+		fmt.Printf("♻️  %s already holds this snapshot, skipping unpack (--fresh rebuilds it)\n", sandboxDir)
+		if len(changes) > 0 {
+			fmt.Printf("   ✏️  Keeping %d change(s) made in the sandbox\n", len(changes))
+		}
+		if err := start.TouchSandbox(sandboxDir); err != nil {
+			fmt.Printf("   ⚠️  %v\n", err)
+		}
+	} else {
+		// Unpacking again replaces the sandbox: don't lose edits made in it
+		if len(changes) > 0 {
+			fmt.Printf("✏️  %s has %d change(s) since it was unpacked:\n", sandboxDir, len(changes))
+			printChanges(changes, 5)
+			if !start.Confirm("Discard them and unpack the snapshot again?", false) {
+				fmt.Println("Kept the sandbox. Use --name or --dir to start the snapshot somewhere else.")
+				return nil
+			}
+		}
+
+		// 2b. Unpack (virtualenvs are kept for reuse unless fresh)
+		fmt.Printf("📂 Opening snapshot %s to %s...\n", snapshotFile, sandboxDir)
+		if meta, err = start.PrepareSandbox(snapshotFile, sandboxDir, snapshotID, fresh); err != nil {
+			return fmt.Errorf("unpacking: %w", err)
+		}
+	}
+
+	// 3. Run
+	if err := start.Run(sandboxDir, meta, opts); err != nil {
+		return fmt.Errorf("running snapshot: %w", err)
+	}
+	return nil
+}
+
+// printChanges lists sandbox changes, at most max of them
+func printChanges(changes []start.Change, max int) {
+	icons := map[string]string{"modified": "📝", "added": "➕", "deleted": "➖"}
+	for i, c := range changes {
+		if i == max {
+			fmt.Printf("   ... and %d more\n", len(changes)-max)
+			break
+		}
+		fmt.Printf("   %s %s\n", icons[c.Kind], c.Path)
+	}
+}
+
+func handleSandbox(args []string) {
+	usage := "Usage: devsnap sandbox list | rm <name|dir> [--force|-f] | prune | diff [name|dir] | export-patch [name|dir] [-o file]"
+	if len(args) < 1 {
+		fmt.Println(usage)
 		os.Exit(1)
 	}
 
-	// 1. Unpack
-	// Use a local sandbox directory for visibility, as requested
-	sandboxDir := ".devsnap_sandbox"
-	fmt.Printf("📂 Opening snapshot %s to %s...\n", snapshotFile, sandboxDir)
+	switch args[0] {
+	case "list", "ls":
+		entries, err := start.ListSandboxes()
+		if err != nil {
+			fmt.Printf("Error listing sandboxes: %v\n", err)
+			os.Exit(1)
+		}
+		if len(entries) == 0 {
+			fmt.Println("No sandboxes.")
+			return
+		}
+		for _, e := range entries {
+			fmt.Printf("📦 %-36s %-20s last used %s  %s\n", e.Name(), e.Info.Snapshot, e.Info.LastUsed.Format("2006-01-02 15:04"), sandboxStatus(e.Dir))
+		}
 
-	// Clean up previous sandbox if exists to ensure fresh start
-	os.RemoveAll(sandboxDir)
+	case "rm", "remove":
+		force := false
+		var targets []string
+		for _, arg := range args[1:] {
+			if arg == "--force" || arg == "-f" {
+				force = true
+			} else {
+				targets = append(targets, arg)
+			}
+		}
+		if len(targets) == 0 {
+			fmt.Println(usage)
+			os.Exit(1)
+		}
+		failed := false
+		for _, target := range targets {
+			e, err := start.FindSandbox(target)
+			if err != nil {
+				fmt.Printf("   ❌ %v\n", err)
+				failed = true
+				continue
+			}
+			if changes, _ := start.SandboxChanges(e.Dir); len(changes) > 0 && !force {
+				fmt.Printf("✏️  %s has %d change(s) since it was unpacked:\n", e.Name(), len(changes))
+				printChanges(changes, 5)
+				if !start.Confirm("Delete it anyway?", false) {
+					continue
+				}
+			}
+			if err := start.RemoveSandbox(e.Dir); err != nil {
+				fmt.Printf("   ❌ %s: %v\n", e.Name(), err)
+				failed = true
+				continue
+			}
+			fmt.Printf("   🗑️  Removed %s\n", e.Name())
+		}
+		if failed {
+			os.Exit(1)
+		}
+
+	case "prune":
+		entries, err := start.ListSandboxes()
+		if err != nil {
+			fmt.Printf("Error listing sandboxes: %v\n", err)
+			os.Exit(1)
+		}
+		removed := 0
+		for _, e := range entries {
+			// Directories picked with --dir are the user's to delete
+			if !e.Managed() || start.SandboxLocked(e.Dir) || start.HasRunning(e.Dir) {
+				continue
+			}
+			if changes, _ := start.SandboxChanges(e.Dir); len(changes) > 0 {
+				fmt.Printf("   ✏️  Kept %s (%d change(s), remove it with 'devsnap sandbox rm')\n", e.Name(), len(changes))
+				continue
+			}
+			if err := start.RemoveSandbox(e.Dir); err != nil {
+				fmt.Printf("   ❌ %s: %v\n", e.Name(), err)
+				continue
+			}
+			fmt.Printf("   🗑️  Removed %s\n", e.Name())
+			removed++
+		}
+		fmt.Printf("✅ Pruned %d sandbox(es).\n", removed)
+
+	case "diff":
+		target := ""
+		if len(args) > 1 {
+			target = args[1]
+		}
+		dir := pickSandbox(target)
+		changes, err := start.SandboxChanges(dir)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(changes) == 0 {
+			fmt.Println("No changes since the sandbox was unpacked.")
+			return
+		}
+		fmt.Printf("✏️  %d change(s) in %s:\n", len(changes), dir)
+		printChanges(changes, len(changes))
+		fmt.Println()
+		skipped, err := start.WriteSandboxDiff(dir, changes, os.Stdout, false)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, path := range skipped {
+			fmt.Printf("⚠️  %s: the snapshot has no original to compare with\n", path)
+		}
+
+	case "export-patch":
+		target, output := "", ""
+		for i := 1; i < len(args); i++ {
+			switch args[i] {
+			case "-o", "--output":
+				if i+1 < len(args) {
+					output = args[i+1]
+					i++
+				}
+			default:
+				target = args[i]
+			}
+		}
+		dir := pickSandbox(target)
+		changes, err := start.SandboxChanges(dir)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(changes) == 0 {
+			fmt.Println("No changes since the sandbox was unpacked.")
+			return
+		}
+		if output == "" {
+			output = mustReadSandboxInfo(dir).Snapshot + ".patch"
+		}
+
+		// "-" writes to stdout, for piping into git apply
+		var w io.Writer = os.Stdout
+		if output != "-" {
+			f, err := os.Create(output)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			defer f.Close()
+			w = f
+		}
+		skipped, err := start.WriteSandboxDiff(dir, changes, w, true)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, path := range skipped {
+			fmt.Fprintf(os.Stderr, "⚠️  Left out %s (binary, or not in the snapshot)\n", path)
+		}
+		if output != "-" {
+			fmt.Printf("✅ Wrote %d change(s) to %s (apply with 'git apply %s')\n", len(changes)-len(skipped), output, output)
+		}
 
-	meta, err := start.Unpack(snapshotFile, sandboxDir)
+	default:
+		fmt.Printf("Unknown sandbox command: %s\n", args[0])
+		fmt.Println(usage)
+		os.Exit(1)
+	}
+}
+
+// mustReadSandboxInfo reads the info of a sandbox, exiting if dir isn't one
+func mustReadSandboxInfo(dir string) *start.SandboxInfo {
+	info, err := start.ReadSandboxInfo(dir)
 	if err != nil {
-		fmt.Printf("Error unpacking: %v\n", err)
+		fmt.Printf("Error reading sandbox info: %v\n", err)
 		os.Exit(1)
 	}
+	if info == nil {
+		fmt.Printf("Error: %s is not a devsnap sandbox\n", dir)
+		os.Exit(1)
+	}
+	return info
+}
 
-	// 2. Run
-	err = start.Run(sandboxDir, meta, manualMode)
+// pickSandbox resolves the sandbox a command acts on: the one named, else the current
+// directory if it is a sandbox, else the only sandbox there is.
+func pickSandbox(target string) string {
+	if target != "" {
+		e, err := start.FindSandbox(target)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return e.Dir
+	}
+	if info, _ := start.ReadSandboxInfo("."); info != nil {
+		wd, _ := os.Getwd()
+		return wd
+	}
+	entries, err := start.ListSandboxes()
 	if err != nil {
-		fmt.Printf("Error running snapshot: %v\n", err)
+		fmt.Printf("Error listing sandboxes: %v\n", err)
+		os.Exit(1)
+	}
+	switch len(entries) {
+	case 0:
+		fmt.Println("Error: no sandboxes. Unpack one with 'devsnap start'.")
+	case 1:
+		return entries[0].Dir
+	default:
+		fmt.Println("Error: several sandboxes, name one:")
+		for _, e := range entries {
+			fmt.Printf("   %s (%s)\n", e.Name(), e.Info.Snapshot)
+		}
+	}
+	os.Exit(1)
+	return ""
+}
+
+// sandboxStatus summarizes what keeps a sandbox from being pruned
+func sandboxStatus(dir string) string {
+	var status []string
+	if start.HasRunning(dir) {
+		status = append(status, "🟢 running")
+	}
+	if start.SandboxLocked(dir) {
+		status = append(status, "🔒 in use")
+	}
+	if changes, _ := start.SandboxChanges(dir); len(changes) > 0 {
+		status = append(status, fmt.Sprintf("✏️  %d change(s)", len(changes)))
+	}
+	return strings.Join(status, ", ")
+}
+
+func handleRestore(args []string) {
+	usage := "Usage: devsnap restore <snapshot-file> [dir] [--dry-run] [--overwrite | --merge]"
+	var opts start.RestoreOptions
+	var positional []string
+	for _, arg := range args {
+		switch arg {
+		case "--dry-run", "-n":
+			opts.DryRun = true
+		case "--overwrite":
+			opts.Overwrite = true
+		case "--merge":
+			opts.Merge = true
+		default:
+			positional = append(positional, arg)
+		}
+	}
+	if len(positional) < 1 || len(positional) > 2 || (opts.Overwrite && opts.Merge) {
+		fmt.Println(usage)
+		os.Exit(1)
+	}
+	target := "."
+	if len(positional) == 2 {
+		target = positional[1]
+	}
+
+	abs, _ := filepath.Abs(target)
+	fmt.Printf("🔄 Restoring %s onto %s...\n", positional[0], abs)
+	if err := start.Restore(positional[0], target, opts); err != nil {
+		if !errors.Is(err, start.ErrRestoreConflicts) {
+			fmt.Printf("Error: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// materializeDir resolves the directory materialize works in: the sandbox or directory
+// named, else the current directory if it has devpacks, else the only sandbox there is,
+// else the sandbox older versions unpacked to.
+func materializeDir(target string) string {
+	if target != "" {
+		if e, err := start.FindSandbox(target); err == nil {
+			return e.Dir
+		}
+		if info, err := os.Stat(target); err != nil || !info.IsDir() {
+			fmt.Printf("Error: no sandbox or directory '%s' (see 'devsnap sandbox list')\n", target)
+			os.Exit(1)
+		}
+		return target
+	}
+	if len(findDevpacks(".")) > 0 {
+		return "."
+	}
+	entries, _ := start.ListSandboxes()
+	switch len(entries) {
+	case 0:
+		if info, err := os.Stat(".devsnap_sandbox"); err == nil && info.IsDir() {
+			return ".devsnap_sandbox"
+		}
+		return "."
+	case 1:
+		return entries[0].Dir
+	}
+	fmt.Println("Error: several sandboxes, name one:")
+	for _, e := range entries {
+		fmt.Printf("   %s (%s)\n", e.Name(), e.Info.Snapshot)
+	}
+	os.Exit(1)
+	return ""
+}
+
+// findDevpacks lists the devpacks in dir
+func findDevpacks(dir string) []string {
+	packs, _ := filepath.Glob(filepath.Join(dir, metadata.GeneratedDir, "*.devpack"))
+	legacy, _ := filepath.Glob(filepath.Join(dir, "*.devpack")) // Snapshots made before devpacks moved
+	return append(packs, legacy...)
+}
+
+func handleMaterialize(args []string) {
+	force := false
+	dir := ""
+	for _, arg := range args {
+		if arg == "--force" || arg == "-f" {
+			force = true
+		} else {
+			dir = arg
+		}
+	}
+	dir = materializeDir(dir)
+
+	// The snapshot metadata names the project and pins the Go version
+	var meta metadata.SnapshotMetadata
+	if content, err := ioutil.ReadFile(filepath.Join(dir, "metadata.json")); err == nil {
+		json.Unmarshal(content, &meta)
+	}
+	abs, _ := filepath.Abs(dir)
+	if meta.Name == "" {
+		meta.Name = filepath.Base(abs)
+	}
+	goVersion := ""
+	for _, env := range meta.Environments {
+		if env.Type == "go" {
+			goVersion = env.Version
+		}
+	}
+
+	packs := findDevpacks(dir)
+	if len(packs) == 0 {
+		fmt.Printf("No devpacks in %s, nothing to materialize.\n", dir)
+		return
+	}
+
+	fmt.Printf("📦 Materializing devpacks in %s...\n", abs)
+	failed := false
+	for _, path := range packs {
+		pack, err := devpack.ReadFile(path)
+		if err != nil {
+			fmt.Printf("   ❌ %s: %v\n", filepath.Base(path), err)
+			failed = true
+			continue
+		}
+
+		file, queries, err := pack.Materialize(dir, meta.Name, goVersion, force)
+		if err == devpack.ErrManifestExists {
+			fmt.Printf("   ⏭️  %s already exists (use --force to overwrite)\n", file)
+			continue
+		}
+		if err != nil {
+			fmt.Printf("   ❌ %s: %v\n", file, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("   ✅ %s -> %s (%d dependencies)\n", filepath.Base(path), file, len(pack.Dependencies))
+		if unpinned := pack.Unpinned(); len(unpinned) > 0 && pack.Ecosystem != devpack.Go {
+			fmt.Printf("      ⚠️  Unpinned: %s\n", strings.Join(unpinned, ", "))
+		}
+		if pack.Ecosystem == devpack.Go {
+			next := "go mod tidy"
+			if len(queries) > 0 {
+				next = "go get " + strings.Join(queries, " ") + " && " + next
+			}
+			fmt.Printf("      💡 Next: %s\n", next)
+		}
+	}
+	if failed {
 		os.Exit(1)
 	}
 }
@@ -205,17 +830,94 @@ func handleInspect(args []string) {
 			fmt.Println("\n🔍 Snapshot Metadata")
 			fmt.Println("--------------------")
 			fmt.Printf("Name:        %s\n", meta.Name)
+			if meta.Description != "" {
+				fmt.Printf("Description: %s\n", meta.Description)
+			}
+			if meta.Author != "" {
+				fmt.Printf("Author:      %s\n", meta.Author)
+			}
+			if len(meta.Tags) > 0 {
+				fmt.Printf("Tags:        %s\n", strings.Join(meta.Tags, ", "))
+			}
 			fmt.Printf("Created:     %s\n", meta.CreatedAt)
+			if meta.Parent != nil {
+				fmt.Printf("Parent:      %s (%.12s)\n", meta.Parent.Name, meta.Parent.ID)
+			}
+			if g := meta.Git; g != nil {
+				fmt.Printf("Git:         %.12s", g.Commit)
+				if g.Branch != "" {
+					fmt.Printf(" on %s", g.Branch)
+				}
+				if g.Path != "" {
+					fmt.Printf(" in %s", g.Path)
+				}
+				if g.Dirty {
+					fmt.Print(" (with uncommitted changes)")
+				}
+				fmt.Println()
+				if g.Remote != "" {
+					fmt.Printf("Remote:      %s\n", g.Remote)
+				}
+			}
 
 			fmt.Println("Environments:")
 			for _, env := range meta.Environments {
-				fmt.Printf("  - %s (%s)\n", env.Type, env.Version)
+				fmt.Printf("  - %s (%s)", env.Type, env.Version)
+				if env.VersionSource != "" {
+					fmt.Printf(" from %s", env.VersionSource)
+				}
+				fmt.Println()
+				if env.Dir != "" {
+					fmt.Printf("    Dir:   %s\n", env.Dir)
+				}
+				if env.PackageManager != "" {
+					fmt.Printf("    Package Manager: %s\n", env.PackageManager)
+				}
+				if env.Framework != "" {
+					fmt.Printf("    Framework: %s\n", env.Framework)
+				}
+				if env.Port != 0 {
+					host := env.Host
+					if host == "" {
+						host = "localhost"
+					}
+					fmt.Printf("    URL:   http://%s:%d\n", host, env.Port)
+				}
 				if len(env.Setup) > 0 {
 					fmt.Printf("    Setup: %v\n", env.Setup)
 				}
 				if env.Run != "" {
 					fmt.Printf("    Run:   %s\n", env.Run)
 				}
+				if env.Test != "" {
+					fmt.Printf("    Test:  %s\n", env.Test)
+				}
+				if env.Name != "" {
+					fmt.Printf("    Name:  %s\n", env.Name)
+				}
+				if len(env.DependsOn) > 0 {
+					fmt.Printf("    Depends on: %s\n", strings.Join(env.DependsOn, ", "))
+				}
+				if len(env.Unpinned) > 0 {
+					fmt.Printf("    ⚠️  Unpinned: %s (latest at start)\n", strings.Join(env.Unpinned, ", "))
+				}
+			}
+
+			if len(meta.Variables) > 0 {
+				fmt.Println("Variables:")
+				for _, v := range meta.Variables {
+					flags := ""
+					if v.Required {
+						flags = " (required)"
+					}
+					fmt.Printf("  - %s%s", v.Name, flags)
+					if v.Description != "" {
+						fmt.Printf(": %s", v.Description)
+					}
+					fmt.Println()
+				}
+			} else if len(meta.RequiredVars) > 0 {
+				fmt.Printf("Required Vars: %s\n", strings.Join(meta.RequiredVars, ", "))
 			}
 
 			// Legacy/Global commands
@@ -230,3 +932,134 @@ func handleInspect(args []string) {
 	}
 	fmt.Println("Error: metadata.json not found in snapshot")
 }
+
+func handlePs() {
+	states, err := start.RunningSandboxes()
+	if err != nil {
+		fmt.Printf("Error listing sandboxes: %v\n", err)
+		os.Exit(1)
+	}
+	if len(states) == 0 {
+		fmt.Println("No detached services running.")
+		return
+	}
+	for _, st := range states {
+		fmt.Printf("📦 %s  (%s, started %s)\n", st.Snapshot, st.Sandbox, st.Started.Format("2006-01-02 15:04"))
+		for _, svc := range st.Services {
+			status := "✅ running"
+			if !svc.Running() {
+				status = "💤 exited "
+			}
+			name := svc.Name
+			if svc.Framework != "" {
+				name += " (" + svc.Framework + ")"
+			}
+			fmt.Printf("   %s  %-28s pid %-7d %s\n", status, name, svc.PID, svc.URL)
+		}
+	}
+}
+
+func handleLogs(args []string) {
+	follow := false
+	sandbox, service := "", ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-f", "--follow":
+			follow = true
+		case "--sandbox":
+			if i+1 < len(args) {
+				sandbox = args[i+1]
+				i++
+			}
+		default:
+			service = args[i]
+		}
+	}
+
+	dir, state := findRunState(sandbox, service)
+	svc, err := state.Find(service)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := start.TailLog(dir, *svc, follow, os.Stdout); err != nil {
+		fmt.Printf("Error reading log: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func handleStop(args []string) {
+	timeout := 10 * time.Second
+	sandbox, service := "", ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--timeout", "-t":
+			if i+1 < len(args) {
+				d, err := time.ParseDuration(args[i+1])
+				if err != nil {
+					fmt.Printf("Error: invalid timeout %q\n", args[i+1])
+					os.Exit(1)
+				}
+				timeout = d
+				i++
+			}
+		case "--sandbox":
+			if i+1 < len(args) {
+				sandbox = args[i+1]
+				i++
+			}
+		default:
+			service = args[i]
+		}
+	}
+
+	dir, _ := findRunState(sandbox, service)
+	if err := start.Stop(dir, service, timeout); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("✅ Stopped.")
+}
+
+// findRunState picks the sandbox logs and stop act on: --sandbox, else the current
+// directory (or its legacy .devsnap_sandbox), else the only running sandbox with that service.
+func findRunState(sandbox, service string) (string, *start.RunState) {
+	if sandbox == "" {
+		for _, dir := range []string{".", ".devsnap_sandbox"} {
+			if st, _ := start.ReadRunState(dir); st != nil {
+				return dir, st
+			}
+		}
+		states, _ := start.RunningSandboxes()
+		var matches []*start.RunState
+		for _, st := range states {
+			if _, err := st.Find(service); err == nil || service == "" {
+				matches = append(matches, st)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			fmt.Println("Error: no detached services found. Start some with 'devsnap start --detach'.")
+			os.Exit(1)
+		case 1:
+			return matches[0].Sandbox, matches[0]
+		default:
+			fmt.Println("Error: several sandboxes match, pick one with --sandbox:")
+			for _, st := range matches {
+				fmt.Printf("   %s (%s)\n", st.Sandbox, st.Snapshot)
+			}
+			os.Exit(1)
+		}
+	}
+
+	// A name or path of a known sandbox, else a plain directory (e.g. an old .devsnap_sandbox)
+	if e, err := start.FindSandbox(sandbox); err == nil {
+		sandbox = e.Dir
+	}
+	st, err := start.ReadRunState(sandbox)
+	if err != nil || st == nil {
+		fmt.Printf("Error: no detached services in %s\n", sandbox)
+		os.Exit(1)
+	}
+	return sandbox, st
+}
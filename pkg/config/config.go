@@ -0,0 +1,294 @@
+package config
+
+import (
+	"bytes"
+	"devsnap/pkg/metadata"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileNames are the project-level config files devsnap looks for, in order of precedence.
+var FileNames = []string{"devsnap.json", "devsnap.yaml", "devsnap.yml"}
+
+// Detection modes
+const (
+	// DetectionMerge layers the config on top of auto-detection (default)
+	DetectionMerge = "merge"
+	// DetectionReplace skips auto-detected environments and uses the config ones only
+	DetectionReplace = "replace"
+)
+
+// ProjectConfig is the checked-in override file (devsnap.json / devsnap.yaml).
+// It corrects what auto-detection guessed and sets fields detection can't know.
+type ProjectConfig struct {
+	// Identity
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Author      string   `json:"author,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+
+	// Detection is "merge" (default) or "replace"
+	Detection string `json:"detection,omitempty"`
+
+	// Environments are merged by type and dir into the detected ones (or replace them)
+	Environments []metadata.EnvironmentConfig `json:"environments,omitempty"`
+
+	// Include re-adds files the default ignores skip (e.g. "dist/bundle.js").
+	// Exclude drops files from the archive. Both are glob patterns matched
+	// against the relative path, the base name, or a leading directory.
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+
+	// TestImports makes Sherlock count imports from test files (e.g. _test.go) as dependencies
+	TestImports bool `json:"test_imports,omitempty"`
+
+	// RequiredVars is the short form of Variables (names only, all required)
+	RequiredVars []string                      `json:"required_vars,omitempty"`
+	Variables    []metadata.VariableDefinition `json:"variables,omitempty"`
+
+	// path is the file this config was loaded from (empty for new configs)
+	path string
+}
+
+// Load reads the project config from root.
+// Returns nil (and no error) if the project has no config file.
+func Load(root string) (*ProjectConfig, error) {
+	for _, name := range FileNames {
+		path := filepath.Join(root, name)
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		// YAML is decoded generically and re-encoded as JSON so that the
+		// json tags on the metadata types stay the single source of field names
+		if isYAML(name) {
+			var generic interface{}
+			if err := yaml.Unmarshal(content, &generic); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+			}
+			if content, err = json.Marshal(generic); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+			}
+		}
+
+		var cfg ProjectConfig
+		if err := json.Unmarshal(content, &cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		if err := cfg.validate(); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+		cfg.path = path
+		return &cfg, nil
+	}
+	return nil, nil
+}
+
+// Save writes the project config back to the file it was loaded from,
+// or to devsnap.json in root for a new config.
+func Save(root string, cfg *ProjectConfig) error {
+	path := cfg.path
+	if path == "" {
+		path = filepath.Join(root, FileNames[0])
+	}
+
+	// Keep ">=" and "&&" readable, this file is meant to be edited by hand
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(cfg); err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	out := buf.Bytes()
+	if isYAML(path) {
+		var generic interface{}
+		if err := json.Unmarshal(out, &generic); err != nil {
+			return fmt.Errorf("failed to marshal config: %w", err)
+		}
+		yamlOut, err := yaml.Marshal(generic)
+		if err != nil {
+			return fmt.Errorf("failed to marshal config: %w", err)
+		}
+		out = yamlOut
+	}
+	return ioutil.WriteFile(path, out, 0644)
+}
+
+// FileName returns the base name of the file the config was loaded from
+func (c *ProjectConfig) FileName() string {
+	if c == nil || c.path == "" {
+		return FileNames[0]
+	}
+	return filepath.Base(c.path)
+}
+
+// Replaces reports whether the config replaces auto-detection instead of merging with it
+func (c *ProjectConfig) Replaces() bool {
+	return c != nil && c.Detection == DetectionReplace
+}
+
+// Excludes reports whether the given path (relative to the project root) matches an exclude pattern.
+func (c *ProjectConfig) Excludes(relPath string) bool {
+	if c == nil {
+		return false
+	}
+	return MatchAny(c.Exclude, relPath)
+}
+
+// Includes reports whether the given path (relative to the project root) matches an include pattern.
+func (c *ProjectConfig) Includes(relPath string) bool {
+	if c == nil {
+		return false
+	}
+	return MatchAny(c.Include, relPath)
+}
+
+// MergeEnvironments layers the configured environments on top of the detected ones.
+// Environments are matched by type and dir; non-empty config fields win, unmatched ones are appended.
+func (c *ProjectConfig) MergeEnvironments(detected []metadata.EnvironmentConfig) []metadata.EnvironmentConfig {
+	if c == nil || len(c.Environments) == 0 {
+		return detected
+	}
+	if c.Replaces() {
+		return append([]metadata.EnvironmentConfig(nil), c.Environments...)
+	}
+
+	merged := append([]metadata.EnvironmentConfig(nil), detected...)
+	for _, override := range c.Environments {
+		found := false
+		for i := range merged {
+			if merged[i].Type == override.Type && merged[i].Dir == override.Dir {
+				merged[i] = mergeEnvironment(merged[i], override, c.FileName())
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, override)
+		}
+	}
+	return merged
+}
+
+// mergeEnvironment applies the non-empty fields of override, read from the config file source
+func mergeEnvironment(base, override metadata.EnvironmentConfig, source string) metadata.EnvironmentConfig {
+	if override.Version != "" {
+		// The detected source no longer applies: the version comes from the config
+		base.Version, base.VersionSource = override.Version, override.VersionSource
+		if base.VersionSource == "" {
+			base.VersionSource = source
+		}
+	}
+	if override.PackageManager != "" {
+		base.PackageManager = override.PackageManager
+	}
+	if override.Image != "" {
+		base.Image = override.Image
+	}
+	if override.Framework != "" {
+		base.Framework = override.Framework
+	}
+	if override.Port != 0 {
+		base.Port = override.Port
+	}
+	if override.Host != "" {
+		base.Host = override.Host
+	}
+	if override.PortVar != "" {
+		base.PortVar = override.PortVar
+	}
+	if override.PortFixed {
+		base.PortFixed = true
+	}
+	if override.Name != "" {
+		base.Name = override.Name
+	}
+	if override.DependsOn != nil {
+		base.DependsOn = override.DependsOn
+	}
+	if override.Ready != nil {
+		base.Ready = override.Ready
+	}
+	if override.Setup != nil {
+		base.Setup = override.Setup
+	}
+	if override.Run != "" {
+		base.Run = override.Run
+	}
+	if override.Test != "" {
+		base.Test = override.Test
+	}
+	return base
+}
+
+func (c *ProjectConfig) validate() error {
+	switch c.Detection {
+	case "", DetectionMerge, DetectionReplace:
+	default:
+		return fmt.Errorf("detection must be %q or %q, got %q", DetectionMerge, DetectionReplace, c.Detection)
+	}
+	for i, e := range c.Environments {
+		if e.Type == "" {
+			return fmt.Errorf("environment #%d has no type", i+1)
+		}
+	}
+	for i, v := range c.Variables {
+		if v.Name == "" {
+			return fmt.Errorf("variable #%d has no name", i+1)
+		}
+	}
+	return nil
+}
+
+// MatchAny reports whether relPath matches any of the glob patterns.
+// A pattern matches the full relative path, the base name, or any leading directory.
+func MatchAny(patterns []string, relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+	for _, p := range patterns {
+		p = strings.TrimSuffix(filepath.ToSlash(strings.TrimSpace(p)), "/")
+		if p == "" {
+			continue
+		}
+		if ok, _ := filepath.Match(p, relPath); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(p, filepath.Base(relPath)); ok {
+			return true
+		}
+		// Directory prefix match: "docs" excludes "docs/a/b.md"
+		if strings.HasPrefix(relPath, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// CouldMatchUnder reports whether any pattern may match a path below dir.
+// Used to decide whether an ignored directory needs to be walked for includes.
+func CouldMatchUnder(patterns []string, dir string) bool {
+	dir = filepath.ToSlash(dir)
+	for _, p := range patterns {
+		p = strings.TrimSuffix(filepath.ToSlash(strings.TrimSpace(p)), "/")
+		if p == dir || strings.HasPrefix(p, dir+"/") || strings.HasPrefix(dir, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func isYAML(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".yaml" || ext == ".yml"
+}
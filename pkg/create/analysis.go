@@ -0,0 +1,102 @@
+package create
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// maxAnalyzedSize skips huge sources (minified bundles, generated code) in the analyzers; they are still archived
+const maxAnalyzedSize = 2 << 20
+
+// analyzer extracts facts from one source file into a named bucket
+type analyzer struct {
+	bucket string
+	match  func(path string) bool
+	run    func(path string, content []byte) []string
+}
+
+var analyzers = []analyzer{
+	{"env", isCodeFile, envVarsIn},
+	{"node", hasExt(".js", ".ts", ".jsx", ".tsx"), nodeImportsIn},
+	{"python", hasExt(".py"), pythonImportsIn},
+	{"go", func(p string) bool { return hasExt(".go")(p) && !strings.HasSuffix(p, "_test.go") }, goImportsIn},
+	{"go-test", func(p string) bool { return strings.HasSuffix(p, "_test.go") }, goImportsIn},
+}
+
+func hasExt(exts ...string) func(string) bool {
+	return func(path string) bool {
+		ext := strings.ToLower(filepath.Ext(path))
+		for _, e := range exts {
+			if ext == e {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// isCodeFile reports whether a file is a source the analyzers read
+var isCodeFile = hasExt(".js", ".ts", ".jsx", ".tsx", ".go", ".py")
+
+// analysisJob runs one analyzer on one file
+type analysisJob struct {
+	path string
+	an   *analyzer
+}
+
+// fileCache shares one read of a file between the analyzers that need it.
+// A file's content is dropped when the last of them is done, so memory is
+// bounded by the files in flight rather than the size of the project.
+type fileCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedFile
+}
+
+type cachedFile struct {
+	once    sync.Once
+	content []byte
+	err     error
+	readers int
+}
+
+func newFileCache() *fileCache {
+	return &fileCache{entries: make(map[string]*cachedFile)}
+}
+
+// expect registers how many analyzers will read path
+func (c *fileCache) expect(path string, readers int) {
+	if readers == 0 {
+		return
+	}
+	c.mu.Lock()
+	c.entries[path] = &cachedFile{readers: readers}
+	c.mu.Unlock()
+}
+
+// get returns the content of path, reading it on first use
+func (c *fileCache) get(path string) ([]byte, error) {
+	c.mu.Lock()
+	entry := c.entries[path]
+	c.mu.Unlock()
+	if entry == nil {
+		return ioutil.ReadFile(path)
+	}
+	entry.once.Do(func() {
+		entry.content, entry.err = ioutil.ReadFile(path)
+	})
+	return entry.content, entry.err
+}
+
+// done releases one reader of path
+func (c *fileCache) done(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry := c.entries[path]; entry != nil {
+		entry.readers--
+		if entry.readers <= 0 {
+			delete(c.entries, path)
+		}
+	}
+}
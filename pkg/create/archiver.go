@@ -9,10 +9,13 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"time"
 )
 
-// CreateArchive packs the given files and metadata into a .devsnap tar.gz file
-func CreateArchive(rootDir string, files []string, meta metadata.SnapshotMetadata, outputPath string) error {
+// CreateArchive packs the given files and metadata into a .devsnap tar.gz file.
+// generated holds files devsnap made (see Project.GeneratedFiles), keyed by archive path.
+func CreateArchive(rootDir string, files []string, generated map[string][]byte, meta metadata.SnapshotMetadata, outputPath string) error {
 	// Create output file
 	outFile, err := os.Create(outputPath)
 	if err != nil {
@@ -46,7 +49,28 @@ func CreateArchive(rootDir string, files []string, meta metadata.SnapshotMetadat
 		return fmt.Errorf("failed to write metadata body: %w", err)
 	}
 
-	// 2. Write project files
+	// 2. Write generated files (devpacks), which only exist in memory
+	names := make([]string, 0, len(generated))
+	for name := range generated {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		header := &tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(generated[name])),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write %s header: %w", name, err)
+		}
+		if _, err := tw.Write(generated[name]); err != nil {
+			return fmt.Errorf("failed to write %s body: %w", name, err)
+		}
+	}
+
+	// 3. Write project files
 	for _, file := range files {
 		if err := addFileToTar(tw, rootDir, file); err != nil {
 			return fmt.Errorf("failed to archive file %s: %w", file, err)
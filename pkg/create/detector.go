@@ -1,57 +1,296 @@
 package create
 
 import (
+	"bytes"
+	"devsnap/pkg/config"
+	"devsnap/pkg/devpack"
 	"devsnap/pkg/metadata"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+
+	"gopkg.in/yaml.v3"
 )
 
-// DetectProject inspects the files and determins the environment configuration
-func DetectProject(root string) ([]metadata.EnvironmentConfig, metadata.LifecycleCommands, string, []string) {
-	// Defaults
+// Project is the result of analysing a project directory
+type Project struct {
+	Name        string
+	Description string
+	Author      string
+	Tags        []string
+
+	Environments []metadata.EnvironmentConfig
+	Commands     metadata.LifecycleCommands
+
+	RequiredVars []string
+	Variables    []metadata.VariableDefinition
+
+	// Devpacks generated by Sherlock, keyed by file name ("go.devpack").
+	// They are archived under metadata.GeneratedDir, never written to the project.
+	Devpacks map[string]*devpack.Devpack
+}
+
+// Options tune detection
+type Options struct {
+	// Offline never runs npm, pip or go to find versions; lockfiles, node_modules,
+	// the Go module cache and earlier cached answers still apply
+	Offline bool
+}
+
+// DetectProject determines the environment configuration from the analysis of a project.
+// If the project has a config file (cfg != nil) it is merged on top of what was detected.
+func DetectProject(a *Analysis, cfg *config.ProjectConfig, opts Options) Project {
+	project := Project{
+		Name:     filepath.Base(a.Root),
+		Commands: metadata.LifecycleCommands{}, // Kept for legacy/global or final override? Can stay empty.
+	}
+
+	// Env Guard
+	requiredVars := a.EnvVars
+
+	// In replace mode the config environments are the whole truth, don't guess.
+	// Their devpacks are still generated: they are never written to the project.
 	var envs []metadata.EnvironmentConfig
-	cmds := metadata.LifecycleCommands{} // Kept for legacy/global or final override? Can stay empty.
-	name := filepath.Base(root)
-
-	// Global Scan for Code Files (for Env Guard & Sherlock)
-	var codeFiles []string
-	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			if info.Name() == "node_modules" || info.Name() == ".git" || info.Name() == "dist" || info.Name() == "build" || info.Name() == "vendor" {
-				return filepath.SkipDir
+	includeTests, res := cfg != nil && cfg.TestImports, newResolver(a.Root, opts.Offline)
+	if cfg.Replaces() {
+		project.Devpacks = referencedDevpacks(a, cfg.Environments, includeTests, res)
+	} else {
+		envs, project.Devpacks = detectEnvironments(a, includeTests, res)
+	}
+
+	if cfg != nil {
+		envs = cfg.MergeEnvironments(envs)
+
+		if cfg.Name != "" {
+			project.Name = cfg.Name
+		}
+		project.Description = cfg.Description
+		project.Author = cfg.Author
+		project.Tags = cfg.Tags
+		project.Variables = cfg.Variables
+
+		if cfg.Replaces() {
+			requiredVars = nil
+		}
+		requiredVars = append(requiredVars, cfg.RequiredVars...)
+		for _, v := range cfg.Variables {
+			if v.Required {
+				requiredVars = append(requiredVars, v.Name)
 			}
-			return nil
 		}
-		ext := strings.ToLower(filepath.Ext(path))
-		if ext == ".js" || ext == ".ts" || ext == ".jsx" || ext == ".tsx" || ext == ".go" || ext == ".py" {
-			codeFiles = append(codeFiles, path)
+		requiredVars = removeDuplicates(requiredVars)
+	}
+
+	// Fallback if nothing detected
+	if len(envs) == 0 {
+		envs = append(envs, metadata.EnvironmentConfig{Type: "generic"})
+	}
+
+	project.Environments = envs
+	project.RequiredVars = requiredVars
+	return project
+}
+
+// detectEnvironments runs the manifest detectors over every directory and Sherlock over the project.
+// res finds the versions of Sherlock dependencies that no lockfile pins.
+func detectEnvironments(a *Analysis, includeTests bool, res *resolver) ([]metadata.EnvironmentConfig, map[string]*devpack.Devpack) {
+	root, dirs, codeFiles := a.Root, a.Dirs, a.CodeFiles
+	var envs []metadata.EnvironmentConfig
+	devpacks := make(map[string]*devpack.Devpack)
+
+	// Workspace roots own the manifests of their members, so an npm workspace
+	// or Cargo workspace is one environment, not one per member package
+	var nodeMembers, cargoMembers, goMembers []string
+
+	for _, dir := range dirs {
+		path := filepath.Join(root, filepath.FromSlash(dir))
+		skip := workspaceSkips{
+			node:  matchesMember(dir, nodeMembers),
+			cargo: matchesMember(dir, cargoMembers),
+			goMod: matchesMember(dir, goMembers),
+		}
+
+		found := detectManifests(path, skip)
+		for i := range found {
+			if dir != "." {
+				found[i].Dir = dir
+				if found[i].VersionSource != "" {
+					found[i].VersionSource = dir + "/" + found[i].VersionSource
+				}
+			}
 		}
-		return nil
-	})
+		envs = append(envs, found...)
 
-	// Env Guard
-	requiredVars := removeDuplicates(scanForEnvVars(codeFiles))
+		if !skip.node {
+			nodeMembers = append(nodeMembers, joinMembers(dir, nodeWorkspaceMembers(path))...)
+		}
+		if !skip.cargo {
+			cargoMembers = append(cargoMembers, joinMembers(dir, cargoWorkspaceMembers(path))...)
+		}
+		if !skip.goMod {
+			goMembers = append(goMembers, joinMembers(dir, goWorkspaceMembers(path))...)
+		}
+	}
+
+	// 4. Sherlock Mode (If no manifests found for a language, try to detect it from code)
+	// We check if we already have detected a language.
+	hasGoEnv := false
+	hasNodeEnv := false
+	hasPyEnv := false
+	for _, e := range envs {
+		if e.Type == "go" {
+			hasGoEnv = true
+		}
+		if strings.HasPrefix(e.Type, "node") || e.Type == "angular" {
+			hasNodeEnv = true
+		}
+		if e.Type == "python" {
+			hasPyEnv = true
+		}
+	}
+
+	// Sherlock Go
+	if !hasGoEnv {
+		hasGoFile := false
+		for _, f := range codeFiles {
+			if strings.HasSuffix(f, ".go") {
+				hasGoFile = true
+				break
+			}
+		}
+
+		if hasGoFile {
+			env := metadata.EnvironmentConfig{Type: "go", Version: "1.21", Run: "go run ."}
+			deps := sherlockDeps(a, "go", includeTests, "", res)
+			if len(deps) > 0 {
+				fmt.Printf("   🕵️  Sherlock (Go): Found %d dependencies. Generating devpack...\n", len(deps))
+				pack, unpinned := sherlockDevpack(root, "go", deps, res)
+				if pack != nil {
+					devpacks["go.devpack"] = pack
+					env.Setup = []string{devpackMarker("go.devpack")}
+				}
+				env.Unpinned = flagUnpinned(unpinned)
+			}
+			applyFramework(root, &env, nameSet("go", deps))
+			envs = append(envs, env)
+		}
+	}
+
+	// Sherlock Node
+	if !hasNodeEnv {
+		// Only check imports if no package.json found
+		deps := sherlockDeps(a, "node", includeTests, "", res)
+		if len(deps) > 0 {
+			env := metadata.EnvironmentConfig{Type: "node", Version: ">=18.0.0"}
+			fmt.Printf("   �️  Sherlock (Node): Found %d dependencies. Generating devpack...\n", len(deps))
+			pack, unpinned := sherlockDevpack(root, "node", deps, res)
+			if pack != nil {
+				devpacks["node.devpack"] = pack
+				env.Setup = []string{devpackMarker("node.devpack")}
+			}
+			env.Unpinned = flagUnpinned(unpinned)
+
+			// Guess run
+			if exists(filepath.Join(root, "index.js")) {
+				env.Run = "node index.js"
+			} else {
+				env.Run = "node " + filepath.Base(codeFiles[0])
+			}
+			applyFramework(root, &env, nameSet("node", deps))
+
+			envs = append(envs, env)
+		}
+	}
+
+	// Sherlock Python (manifests are handled by detectManifests)
+	if !hasPyEnv {
+		// Pure Sherlock Python
+		hasPyFile := false
+		for _, f := range codeFiles {
+			if strings.HasSuffix(f, ".py") {
+				hasPyFile = true
+				break
+			}
+		}
+		if hasPyFile {
+			env := metadata.EnvironmentConfig{Type: "python", Version: "3.10"}
+			// The stdlib differs between versions, so use the pinned one if there is a pin
+			applyPinnedVersion(root, &env)
+			version := ""
+			if env.VersionSource != "" {
+				version = env.Version
+			}
+			deps := sherlockDeps(a, "python", includeTests, version, res)
+			if len(deps) > 0 {
+				fmt.Printf("   �️  Sherlock (Python): Found %d dependencies. Generating devpack...\n", len(deps))
+				pack, unpinned := sherlockDevpack(root, "python", deps, res)
+				if pack != nil {
+					devpacks["python.devpack"] = pack
+					env.Setup = []string{devpackMarker("python.devpack")}
+				}
+				env.Unpinned = flagUnpinned(unpinned)
+			} else {
+				// No deps detected? Maybe just standard lib.
+				// Don't add install command.
+			}
+
+			// Guess run
+			if exists(filepath.Join(root, "main.py")) {
+				env.Run = "python main.py"
+			} else if exists(filepath.Join(root, "app.py")) {
+				env.Run = "python app.py"
+			} else {
+				env.Run = "python " + filepath.Base(codeFiles[0])
+			}
+			applyFramework(root, &env, nameSet("python", deps))
+
+			envs = append(envs, env)
+		}
+	}
+
+	// Pin files (.nvmrc, .python-version, rust-toolchain, ...) are the source of truth
+	for i := range envs {
+		applyPinnedVersion(root, &envs[i])
+	}
+
+	return envs, devpacks
+}
+
+// workspaceSkips marks ecosystems whose manifests are already covered by a workspace root above
+type workspaceSkips struct {
+	node  bool
+	cargo bool
+	goMod bool
+}
+
+// detectManifests checks a single directory for known manifests
+func detectManifests(path string, skip workspaceSkips) []metadata.EnvironmentConfig {
+	var envs []metadata.EnvironmentConfig
 
 	// 1. Check for Angular
-	if exists(filepath.Join(root, "angular.json")) {
+	if !skip.node && exists(filepath.Join(path, "angular.json")) {
+		pkg, _ := readPackageJSON(path)
+		manager, spec, locked := detectNodePackageManager(path)
 		env := metadata.EnvironmentConfig{
-			Type:    "angular",
-			Version: ">=14.0.0",
-			Setup:   []string{"npm install"},
-			Run:     "npm start",
-		}
-		if v := resolveNodeVersion(root, "@angular/core"); v != "" {
+			Type:           "angular",
+			Version:        ">=14.0.0",
+			PackageManager: spec,
+			Setup:          []string{nodeInstallCommand(path, manager, spec, locked)},
+			Run:            nodeScriptCommand(manager, "start"),
+		}
+		if pkg != nil && pkg.Engines.Node != "" {
+			env.Version, env.VersionSource = pkg.Engines.Node, "package.json"
+		} else if v := resolveNodeVersion(path, "@angular/core"); v != "latest" {
 			env.Version = v
 		}
+		if pkg != nil && pkg.runScript() != "" {
+			env.Run = nodeScriptCommand(manager, pkg.runScript())
+		}
 		envs = append(envs, env)
 	}
 
@@ -67,23 +306,29 @@ func DetectProject(root string) ([]metadata.EnvironmentConfig, metadata.Lifecycl
 		}
 	}
 
-	if !alreadyNode && exists(filepath.Join(root, "package.json")) {
+	if !skip.node && !alreadyNode && exists(filepath.Join(path, "package.json")) {
+		pkg, _ := readPackageJSON(path)
+		manager, spec, locked := detectNodePackageManager(path)
 		env := metadata.EnvironmentConfig{
-			Type:    "node",
-			Version: ">=18.0.0",
-			Setup:   []string{"npm install"},
-			Run:     "npm start",
+			Type:           "node",
+			Version:        ">=18.0.0",
+			PackageManager: spec,
+			Setup:          []string{nodeInstallCommand(path, manager, spec, locked)},
+			Run:            nodeRunCommand(path, pkg, manager),
+		}
+		if pkg != nil && pkg.Engines.Node != "" {
+			env.Version, env.VersionSource = pkg.Engines.Node, "package.json"
 		}
 		// TypeScript Enhancement
-		if exists(filepath.Join(root, "tsconfig.json")) {
+		if exists(filepath.Join(path, "tsconfig.json")) {
 			env.Type = "node (TypeScript)"
-			// If build script exists, we might want to run it, but 'npm start' is safer default.
+			// If build script exists, we might want to run it, but the start script is safer default.
 		}
 		envs = append(envs, env)
 	}
 
 	// 3. Check for PHP (composer.json)
-	if exists(filepath.Join(root, "composer.json")) {
+	if exists(filepath.Join(path, "composer.json")) {
 		env := metadata.EnvironmentConfig{
 			Type:    "php",
 			Version: ">=8.0",
@@ -91,24 +336,29 @@ func DetectProject(root string) ([]metadata.EnvironmentConfig, metadata.Lifecycl
 			Run:     "php -S localhost:8000", // Default built-in server
 		}
 		// Try to find an entry point
-		if exists(filepath.Join(root, "public/index.php")) {
+		if exists(filepath.Join(path, "public/index.php")) {
 			env.Run = "php -S localhost:8000 -t public"
-		} else if exists(filepath.Join(root, "artisan")) {
-			// Laravel
-			env.Run = "php artisan serve"
 		}
 		envs = append(envs, env)
 	}
 
-	// 3. Check for Go (go.mod)
-	if exists(filepath.Join(root, "go.mod")) {
+	// 3. Check for Go (go.mod, or a go.work workspace)
+	if !skip.goMod && (exists(filepath.Join(path, "go.mod")) || exists(filepath.Join(path, "go.work"))) {
 		env := metadata.EnvironmentConfig{
 			Type:  "go",
 			Setup: []string{"go mod download"},
 			Run:   "go run .",
 		}
-		if v := resolveGoModVersion(root); v != "" {
+		if !exists(filepath.Join(path, "go.mod")) {
+			// Workspace root without its own module: nothing to "go run" here
+			env.Run = ""
+		}
+		if v := resolveGoModVersion(path); v != "" {
 			env.Version = v
+			env.VersionSource = "go.mod"
+			if !exists(filepath.Join(path, "go.mod")) {
+				env.VersionSource = "go.work"
+			}
 		} else {
 			env.Version = "1.21"
 		}
@@ -116,7 +366,7 @@ func DetectProject(root string) ([]metadata.EnvironmentConfig, metadata.Lifecycl
 	}
 
 	// 4. Check for Rust (Cargo.toml)
-	if exists(filepath.Join(root, "Cargo.toml")) {
+	if !skip.cargo && exists(filepath.Join(path, "Cargo.toml")) {
 		env := metadata.EnvironmentConfig{
 			Type:    "rust",
 			Version: "1.70.0", // Safe default
@@ -127,14 +377,15 @@ func DetectProject(root string) ([]metadata.EnvironmentConfig, metadata.Lifecycl
 	}
 
 	// 5. Check for Java (pom.xml - Maven)
-	if exists(filepath.Join(root, "pom.xml")) {
+	if exists(filepath.Join(path, "pom.xml")) {
 		env := metadata.EnvironmentConfig{
 			Type:    "java",
 			Version: "17",
 			Setup:   []string{"mvn clean install"},
 		}
 		// Smart heuristic for run command
-		if exists(filepath.Join(root, "src/main/resources/application.properties")) || exists(filepath.Join(root, "src/main/resources/application.yml")) {
+		if hasDepPrefix("spring-boot")(path, manifestDeps(path, "java")) ||
+			exists(filepath.Join(path, "src/main/resources/application.properties")) || exists(filepath.Join(path, "src/main/resources/application.yml")) {
 			// Likely Spring Boot
 			env.Run = "mvn spring-boot:run"
 		} else {
@@ -147,193 +398,260 @@ func DetectProject(root string) ([]metadata.EnvironmentConfig, metadata.Lifecycl
 		envs = append(envs, env)
 	}
 
-	// 4. Sherlock Mode (If no manifests found for a language, try to detect it from code)
-	// We check if we already have detected a language.
-	hasGoEnv := false
-	hasNodeEnv := false
-	hasPyEnv := false
-	for _, e := range envs {
-		if e.Type == "go" {
-			hasGoEnv = true
-		}
-		if e.Type == "node" || e.Type == "angular" {
-			hasNodeEnv = true
-		}
-		if e.Type == "python" {
-			hasPyEnv = true
-		}
+	// 6. Check for Python (pyproject.toml, poetry, pipenv, uv, conda, requirements.txt)
+	if env := detectPython(path); env != nil {
+		envs = append(envs, *env)
 	}
 
-	// Sherlock Go
-	if !hasGoEnv {
-		hasGoFile := false
-		for _, f := range codeFiles {
-			if strings.HasSuffix(f, ".go") {
-				hasGoFile = true
-				break
-			}
+	// 7. Check for Ruby (Gemfile)
+	if exists(filepath.Join(path, "Gemfile")) {
+		env := metadata.EnvironmentConfig{
+			Type:    "ruby",
+			Version: "3.2",
+			Setup:   []string{"bundle install"},
 		}
-
-		if hasGoFile {
-			env := metadata.EnvironmentConfig{Type: "go", Version: "1.21", Run: "go run ."}
-			deps := scanForGoImports(codeFiles)
-			if len(deps) > 0 {
-				fmt.Printf("   🕵️  Sherlock (Go): Found %d dependencies. Generating devpack...\n", len(deps))
-				depMap := make(map[string]string)
-				for _, d := range deps {
-					depMap[d] = resolveGoVersion(d)
-				}
-				createDevpack(root, "go", depMap, "go.devpack")
-				env.Setup = []string{"#DEVPACK:go.devpack"}
-			}
-			envs = append(envs, env)
+		if exists(filepath.Join(path, "config.ru")) {
+			// Rack app (Sinatra, Hanami, ...)
+			env.Run = "bundle exec rackup"
 		}
+		envs = append(envs, env)
 	}
 
-	// Sherlock Node
-	if !hasNodeEnv {
-		// Only check imports if no package.json found
-		deps := scanForNodeImports(codeFiles)
-		if len(deps) > 0 {
-			env := metadata.EnvironmentConfig{Type: "node", Version: ">=18.0.0"}
-			fmt.Printf("   �️  Sherlock (Node): Found %d dependencies. Generating devpack...\n", len(deps))
-			depMap := make(map[string]string)
-			for _, d := range deps {
-				depMap[d] = resolveNodeVersion(root, d)
-			}
-			createDevpack(root, "node", depMap, "node.devpack")
-			env.Setup = []string{"#DEVPACK:node.devpack"}
+	// Frameworks refine the run command of the language they build on
+	for i := range envs {
+		applyFramework(path, &envs[i], nil)
+	}
 
-			// Guess run
-			if exists(filepath.Join(root, "index.js")) {
-				env.Run = "node index.js"
-			} else {
-				env.Run = "node " + filepath.Base(codeFiles[0])
-			}
+	return envs
+}
 
-			envs = append(envs, env)
+// nodeWorkspaceMembers returns the npm/yarn/pnpm workspace member globs declared in the directory
+func nodeWorkspaceMembers(path string) []string {
+	if content, err := ioutil.ReadFile(filepath.Join(path, "pnpm-workspace.yaml")); err == nil {
+		var ws struct {
+			Packages []string `yaml:"packages"`
+		}
+		if yaml.Unmarshal(content, &ws) == nil {
+			return ws.Packages
 		}
 	}
 
-	// Sherlock Python (or Manifest Python)
-	// Manifest check: requirements.txt
-	if !hasPyEnv {
-		if exists(filepath.Join(root, "requirements.txt")) {
-			env := metadata.EnvironmentConfig{
-				Type:    "python",
-				Version: ">=3.9",
-				Setup:   []string{"pip install -r requirements.txt"},
-			}
-			if exists(filepath.Join(root, "manage.py")) {
-				env.Run = "python manage.py runserver"
-			} else {
-				env.Run = "python main.py"
-			}
-			envs = append(envs, env)
-		} else {
-			// Pure Sherlock Python
-			hasPyFile := false
-			for _, f := range codeFiles {
-				if strings.HasSuffix(f, ".py") {
-					hasPyFile = true
-					break
-				}
-			}
-			if hasPyFile {
-				env := metadata.EnvironmentConfig{Type: "python", Version: "3.10"}
-				deps := scanForPythonImports(codeFiles)
-				if len(deps) > 0 {
-					fmt.Printf("   �️  Sherlock (Python): Found %d dependencies. Generating devpack...\n", len(deps))
-					depMap := make(map[string]string)
-					for _, d := range deps {
-						depMap[d] = resolvePythonVersion(d)
-					}
-					createDevpack(root, "python", depMap, "python.devpack")
-					env.Setup = []string{"#DEVPACK:python.devpack"}
-				} else {
-					// No deps detected? Maybe just standard lib.
-					// Don't add install command.
-				}
+	pkg, err := readPackageJSON(path)
+	if err != nil || len(pkg.Workspaces) == 0 {
+		return nil
+	}
+	// "workspaces" is either ["packages/*"] or {"packages": ["packages/*"]} (yarn)
+	var list []string
+	if json.Unmarshal(pkg.Workspaces, &list) == nil {
+		return list
+	}
+	var obj struct {
+		Packages []string `json:"packages"`
+	}
+	if json.Unmarshal(pkg.Workspaces, &obj) == nil {
+		return obj.Packages
+	}
+	return nil
+}
 
-				// Guess run
-				if exists(filepath.Join(root, "main.py")) {
-					env.Run = "python main.py"
-				} else if exists(filepath.Join(root, "app.py")) {
-					env.Run = "python app.py"
-				} else {
-					env.Run = "python " + filepath.Base(codeFiles[0])
-				}
+// cargoWorkspaceMembers returns the members of a [workspace] in Cargo.toml
+func cargoWorkspaceMembers(path string) []string {
+	content, err := ioutil.ReadFile(filepath.Join(path, "Cargo.toml"))
+	if err != nil {
+		return nil
+	}
+	str := string(content)
+	ws := regexp.MustCompile(`(?m)^\s*\[workspace\]`).FindStringIndex(str)
+	if ws == nil {
+		return nil
+	}
+	m := regexp.MustCompile(`(?s)members\s*=\s*\[([^\]]*)\]`).FindStringSubmatch(str[ws[1]:])
+	if m == nil {
+		return nil
+	}
+	return quotedStrings(m[1])
+}
 
-				envs = append(envs, env)
-			}
+// goWorkspaceMembers returns the "use" directories of a go.work file
+func goWorkspaceMembers(path string) []string {
+	content, err := ioutil.ReadFile(filepath.Join(path, "go.work"))
+	if err != nil {
+		return nil
+	}
+	var members []string
+	block := regexp.MustCompile(`(?s)use\s*\(([^)]*)\)`)
+	for _, m := range block.FindAllStringSubmatch(string(content), -1) {
+		members = append(members, strings.Fields(m[1])...)
+	}
+	single := regexp.MustCompile(`(?m)^use\s+([^\s(]+)`)
+	for _, m := range single.FindAllStringSubmatch(string(content), -1) {
+		members = append(members, m[1])
+	}
+	return members
+}
+
+// joinMembers makes workspace member globs relative to the project root
+func joinMembers(dir string, members []string) []string {
+	var out []string
+	for _, m := range members {
+		m = strings.Trim(strings.TrimPrefix(filepath.ToSlash(strings.TrimSpace(m)), "./"), `"'`)
+		if m == "" || m == "." || strings.HasPrefix(m, "!") {
+			continue
+		}
+		if dir != "." {
+			m = dir + "/" + m
 		}
+		out = append(out, m)
 	}
+	return out
+}
 
-	// Fallback if nothing detected
-	if len(envs) == 0 {
-		envs = append(envs, metadata.EnvironmentConfig{Type: "generic"})
+// matchesMember reports whether dir is a workspace member ("packages/*" and "packages/**" style globs)
+func matchesMember(dir string, members []string) bool {
+	for _, m := range members {
+		if ok, _ := filepath.Match(m, dir); ok {
+			return true
+		}
+		if strings.HasSuffix(m, "/**") && strings.HasPrefix(dir, strings.TrimSuffix(m, "**")) {
+			return true
+		}
 	}
+	return false
+}
 
-	return envs, cmds, name, requiredVars
+// quotedStrings extracts every "double-quoted" value from s
+func quotedStrings(s string) []string {
+	var out []string
+	for _, m := range regexp.MustCompile(`"([^"]*)"`).FindAllStringSubmatch(s, -1) {
+		out = append(out, m[1])
+	}
+	return out
 }
 
-// createDevpack writes the .devpack file
-func createDevpack(root, envType string, deps map[string]string, filename string) {
-	content := map[string]interface{}{
-		"type":         envType,
-		"dependencies": deps,
+// createDevpack builds the devpack for Sherlock-detected dependencies. Returns nil if it is invalid.
+func createDevpack(envType string, deps map[string]lockedDep, filename string) *devpack.Devpack {
+	pack := devpack.New(devpack.Ecosystem(envType))
+	for name, locked := range deps {
+		dep := devpack.ParseSpec(name, locked.Version)
+		dep.Integrity = locked.Integrity
+		if locked.Dev {
+			dep.Scope = devpack.ScopeDev
+		}
+		pack.Add(dep)
 	}
-	path := filepath.Join(root, filename)
-	bytes, _ := json.MarshalIndent(content, "", "  ")
-	ioutil.WriteFile(path, bytes, 0644)
-	fmt.Printf("   📝 Generated %s\n", filename)
+	if err := pack.Validate(); err != nil {
+		fmt.Printf("   ⚠️  Could not generate %s: %v\n", filename, err)
+		return nil
+	}
+	fmt.Printf("   📝 Generated %s/%s\n", metadata.GeneratedDir, filename)
+	return pack
 }
 
-// --- Node.js Logic ---
+// sherlockDeps returns the dependencies Sherlock finds in the code for a runtime.
+// pythonVersion selects the stdlib to leave out ("" for the default one), and res
+// knows the Go module cache that maps import paths to modules.
+func sherlockDeps(a *Analysis, runtime string, includeTests bool, pythonVersion string, res *resolver) []string {
+	switch runtime {
+	case "go":
+		imports := append([]string{}, a.GoImports...)
+		if includeTests {
+			imports = append(imports, a.GoTestImports...)
+		}
+		return goModules(imports, res.goModCacheDir())
+	case "node":
+		return a.NodeImports
+	case "python":
+		return pythonDependencies(a.Root, a.CodeFiles, a.PythonImports, pythonVersion)
+	}
+	return nil
+}
 
-func scanForNodeImports(files []string) []string {
-	deps := make(map[string]bool)
-	requireRegex := regexp.MustCompile(`require\(['"]([^'"]+)['"]\)`)
-	importRegex := regexp.MustCompile(`from ['"]([^'"]+)['"]`)
-	dynamicRegex := regexp.MustCompile(`import\(['"]([^'"]+)['"]\)`)
+// sherlockDevpack pins deps from the lockfiles in root (or res) and builds the devpack
+// for runtime. It also returns the dependencies nothing could pin.
+func sherlockDevpack(root, runtime string, deps []string, res *resolver) (*devpack.Devpack, []string) {
+	locks, _ := readLocks(root, runtime)
+	depMap, unpinned := resolveDeps(deps, runtime, locks, res)
+	return createDevpack(runtime, depMap, runtime+".devpack"), unpinned
+}
 
-	for _, file := range files {
-		// Only scan JS/TS files
-		if !strings.HasSuffix(file, ".js") && !strings.HasSuffix(file, ".ts") && !strings.HasSuffix(file, ".jsx") && !strings.HasSuffix(file, ".tsx") {
-			continue
+// referencedDevpacks generates the devpacks the setup steps of envs install. In replace
+// mode nothing is detected, but a saved Sherlock environment still points to its devpack.
+func referencedDevpacks(a *Analysis, envs []metadata.EnvironmentConfig, includeTests bool, res *resolver) map[string]*devpack.Devpack {
+	devpacks := make(map[string]*devpack.Devpack)
+	for _, env := range envs {
+		for _, step := range env.Setup {
+			filename := strings.TrimPrefix(step, devpackMarker(""))
+			if filename == step || devpacks[filename] != nil {
+				continue
+			}
+			runtime := strings.TrimSuffix(filename, ".devpack")
+			version := ""
+			if runtime == "python" {
+				version = env.Version
+			}
+			deps := sherlockDeps(a, runtime, includeTests, version, res)
+			if len(deps) == 0 {
+				fmt.Printf("   ⚠️  %s: no %s dependencies found in the code, %s won't be generated\n", env.Type, runtime, filename)
+				continue
+			}
+			fmt.Printf("   🕵️  Sherlock (%s): Found %d dependencies. Generating devpack...\n", runtime, len(deps))
+			if pack, unpinned := sherlockDevpack(a.Root, runtime, deps, res); pack != nil {
+				devpacks[filename] = pack
+				flagUnpinned(unpinned)
+			}
 		}
+	}
+	return devpacks
+}
 
-		content, err := ioutil.ReadFile(file)
-		if err != nil {
-			continue
-		}
-		str := string(content)
+// devpackMarker is the setup step that installs a generated devpack at start
+func devpackMarker(filename string) string {
+	return "#DEVPACK:" + metadata.GeneratedDir + "/" + filename
+}
 
-		add := func(match []string) {
-			if len(match) > 1 {
-				name := match[1]
-				if !isLocalImport(name) && !isBuiltinModule(name) {
-					deps[getRootPackageName(name)] = true
-				}
-			}
+// GeneratedFiles serializes the generated devpacks, keyed by their path inside the archive
+func (p Project) GeneratedFiles() (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	for name, pack := range p.Devpacks {
+		var buf bytes.Buffer
+		if err := pack.Write(&buf); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
 		}
+		files[metadata.GeneratedDir+"/"+name] = buf.Bytes()
+	}
+	return files, nil
+}
 
-		for _, m := range requireRegex.FindAllStringSubmatch(str, -1) {
-			add(m)
-		}
-		for _, m := range importRegex.FindAllStringSubmatch(str, -1) {
-			add(m)
-		}
-		for _, m := range dynamicRegex.FindAllStringSubmatch(str, -1) {
-			add(m)
-		}
+// flagUnpinned warns about dependencies no lockfile or installed package could pin
+func flagUnpinned(unpinned []string) []string {
+	if len(unpinned) == 0 {
+		return nil
 	}
+	sort.Strings(unpinned)
+	fmt.Printf("   ⚠️  Unpinned (will install latest): %s\n", strings.Join(unpinned, ", "))
+	return unpinned
+}
+
+// --- Node.js Logic ---
 
-	var result []string
-	for d := range deps {
-		result = append(result, d)
+var (
+	requireRegex       = regexp.MustCompile(`require\(['"]([^'"]+)['"]\)`)
+	importFromRegex    = regexp.MustCompile(`from ['"]([^'"]+)['"]`)
+	dynamicImportRegex = regexp.MustCompile(`import\(['"]([^'"]+)['"]\)`)
+)
+
+// nodeImportsIn returns the packages a JS/TS file imports, without local files and core modules
+func nodeImportsIn(_ string, content []byte) []string {
+	str := string(content)
+	var deps []string
+	for _, re := range []*regexp.Regexp{requireRegex, importFromRegex, dynamicImportRegex} {
+		for _, m := range re.FindAllStringSubmatch(str, -1) {
+			if name := m[1]; !isLocalImport(name) && !isBuiltinModule(name) {
+				deps = append(deps, getRootPackageName(name))
+			}
+		}
 	}
-	return result
+	return deps
 }
 
 func resolveNodeVersion(root, packageName string) string {
@@ -348,19 +666,10 @@ func resolveNodeVersion(root, packageName string) string {
 		}
 	}
 
-	// 2. Try 'npm list' (Installed but maybe flattened)
-	// Suppress output, just check result
-	cmd := exec.Command("npm", "list", packageName, "--json", "--depth=0")
-	if out, err := cmd.Output(); err == nil {
-		var res struct {
-			Dependencies map[string]struct {
-				Version string `json:"version"`
-			} `json:"dependencies"`
-		}
-		if json.Unmarshal(out, &res) == nil {
-			if val, ok := res.Dependencies[packageName]; ok {
-				return val.Version
-			}
+	// 2. Try the range package.json declares (not installed yet)
+	if pkg, err := readPackageJSON(root); err == nil {
+		if v := pkg.declaredVersion(packageName); v != "" {
+			return v
 		}
 	}
 
@@ -373,7 +682,10 @@ func resolveNodeVersion(root, packageName string) string {
 func resolveGoModVersion(root string) string {
 	content, err := ioutil.ReadFile(filepath.Join(root, "go.mod"))
 	if err != nil {
-		return ""
+		// Workspace roots declare the go version in go.work
+		if content, err = ioutil.ReadFile(filepath.Join(root, "go.work")); err != nil {
+			return ""
+		}
 	}
 
 	re := regexp.MustCompile(`go\s+([0-9]+\.[0-9]+)`)
@@ -384,77 +696,6 @@ func resolveGoModVersion(root string) string {
 	return ""
 }
 
-func scanForGoImports(files []string) []string {
-	deps := make(map[string]bool)
-	importRegex := regexp.MustCompile(`(?m)^\s*import\s*\(\s*((?:[^\)]+\s*)*)\)|^\s*import\s+"([^"]+)"`)
-
-	for _, file := range files {
-		content, err := ioutil.ReadFile(file)
-		if err != nil {
-			continue
-		}
-		str := string(content)
-
-		matches := importRegex.FindAllStringSubmatch(str, -1)
-		for _, m := range matches {
-			if m[2] != "" {
-				// Single line import
-				if !isStandardLib(m[2]) {
-					deps[m[2]] = true
-				}
-			} else if m[1] != "" {
-				// Block import
-				lines := strings.Split(m[1], "\n")
-				for _, line := range lines {
-					line = strings.TrimSpace(line)
-					if line == "" {
-						continue
-					}
-					// Extract string inside quotes
-					if start := strings.Index(line, "\""); start != -1 {
-						if end := strings.LastIndex(line, "\""); end > start {
-							pkg := line[start+1 : end]
-							if !isStandardLib(pkg) {
-								deps[pkg] = true
-							}
-						}
-					}
-				}
-			}
-		}
-	}
-	var res []string
-	for d := range deps {
-		res = append(res, d)
-	}
-	return res
-}
-
-func resolveGoVersion(pkgName string) string {
-	// 1. Try 'go list'
-	cmd := exec.Command("go", "list", "-m", "-f", "{{.Version}}", pkgName)
-	if out, err := cmd.Output(); err == nil {
-		ver := strings.TrimSpace(string(out))
-		if ver != "" {
-			return ver
-		}
-	}
-	return "latest"
-}
-
-func isStandardLib(pkg string) bool {
-	// Heuristic: std lib usually doesn't have "." in the first part (e.g. "fmt", "net/http")
-	// External pkgs usually are "github.com/...", "gopkg.in/..."
-	parts := strings.Split(pkg, "/")
-	if len(parts) > 0 && strings.Contains(parts[0], ".") {
-		return false
-	}
-	// Edge case: "golang.org/x/..." is external but looks like domain
-	// But generally, single word like "fmt" is std.
-	// "net/http" has no domain.
-	return true
-}
-
 // --- Helpers ---
 
 func isLocalImport(path string) bool {
@@ -477,11 +718,11 @@ func getRootPackageName(path string) string {
 }
 
 func isBuiltinModule(name string) bool {
-	builtins := map[string]bool{
-		"fs": true, "path": true, "os": true, "http": true, "https": true,
-		"crypto": true, "util": true, "events": true, "child_process": true,
+	// "node:" imports are always core modules (some, like node:test, only exist with the prefix)
+	if strings.HasPrefix(name, "node:") {
+		return true
 	}
-	return builtins[name]
+	return nodeBuiltins[strings.SplitN(name, "/", 2)[0]]
 }
 
 // exists checks if a file or directory exists
@@ -492,53 +733,30 @@ func exists(path string) bool {
 
 // --- Env Guard Logic ---
 
-func scanForEnvVars(files []string) []string {
-	vars := make(map[string]bool)
-
-	// regexes
+var (
 	// Node: process.env.API_KEY or process.env['API_KEY']
-	nodeRegex := regexp.MustCompile(`process\.env\.([A-Z_0-9]+)|process\.env\['([A-Z_0-9]+)'\]`)
+	nodeEnvRegex = regexp.MustCompile(`process\.env\.([A-Z_0-9]+)|process\.env\['([A-Z_0-9]+)'\]`)
 	// Go: os.Getenv("API_KEY") or os.LookupEnv("API_KEY")
-	goRegex := regexp.MustCompile(`os\.(?:Getenv|LookupEnv)\("([A-Z_0-9]+)"\)`)
+	goEnvRegex = regexp.MustCompile(`os\.(?:Getenv|LookupEnv)\("([A-Z_0-9]+)"\)`)
 	// Python: os.environ.get("API_KEY") or os.getenv("API_KEY") or os.environ["API_KEY"]
-	pyRegex := regexp.MustCompile(`os\.(?:environ\.get|getenv|environ\[")["']([A-Z_0-9]+)["']`)
-
-	for _, file := range files {
-		content, err := ioutil.ReadFile(file)
-		if err != nil {
-			continue
-		}
-		str := string(content)
-
-		for _, m := range nodeRegex.FindAllStringSubmatch(str, -1) {
-			if len(m) > 1 && m[1] != "" {
-				vars[m[1]] = true
-			}
-			if len(m) > 2 && m[2] != "" {
-				vars[m[2]] = true
-			}
-		}
-		for _, m := range goRegex.FindAllStringSubmatch(str, -1) {
+	pyEnvRegex = regexp.MustCompile(`os\.(?:environ\.get|getenv|environ\[")["']([A-Z_0-9]+)["']`)
+)
 
-			if len(m) > 1 {
-				vars[m[1]] = true
-			}
-		}
-		for _, m := range pyRegex.FindAllStringSubmatch(str, -1) {
-			if len(m) > 1 {
-				vars[m[1]] = true
+// envVarsIn returns the environment variables a source file reads
+func envVarsIn(_ string, content []byte) []string {
+	str := string(content)
+	var vars []string
+	for _, re := range []*regexp.Regexp{nodeEnvRegex, goEnvRegex, pyEnvRegex} {
+		for _, m := range re.FindAllStringSubmatch(str, -1) {
+			for _, v := range m[1:] {
+				// Filter out common system ones
+				if v != "" && v != "NODE_ENV" && v != "PATH" {
+					vars = append(vars, v)
+				}
 			}
 		}
 	}
-
-	var result []string
-	for v := range vars {
-		// Filter out common system ones if needed
-		if v != "NODE_ENV" && v != "PATH" {
-			result = append(result, v)
-		}
-	}
-	return result
+	return vars
 }
 
 func removeDuplicates(elements []string) []string {
@@ -554,63 +772,45 @@ func removeDuplicates(elements []string) []string {
 	return result
 }
 
-// scanForPythonImports finds 'import X' or 'from X import Y'
-func scanForPythonImports(files []string) []string {
-	deps := make(map[string]bool)
-	// regex: from X import Y  OR  import X
-	// strict import: ^import\s+([a-zA-Z0-9_]+)
-	// from import: ^from\s+([a-zA-Z0-9_]+)\s+import
-
-	importRegex := regexp.MustCompile(`(?m)^(?:import\s+([a-zA-Z0-9_]+)|from\s+([a-zA-Z0-9_]+)\s+import)`)
-
-	stdLib := map[string]bool{
-		"os": true, "sys": true, "math": true, "json": true, "time": true, "random": true,
-		"datetime": true, "re": true, "subprocess": true, "pathlib": true, "typing": true,
-		"collections": true, "itertools": true, "functools": true, "logging": true,
-		"threading": true, "multiprocessing": true, "socket": true, "email": true,
-		"argparse": true, "shutil": true, "glob": true, "pickle": true, "copy": true,
-		"hashlib": true, "base64": true, "uuid": true, "csv": true, "io": true, "requests": false,
-	}
+// scanForPythonImports finds 'import X' or 'from X import Y' and returns the PyPI distributions to install.
+// Standard library modules (for the given Python version, "" for any) and the project's own modules are skipped.
+// import a.b, c as d  |  from a.b import c   (indented too: imports inside try/def are common)
+var pythonImportRegex = regexp.MustCompile(`(?m)^[ \t]*(?:import\s+([\w.]+(?:\s+as\s+\w+)?(?:[ \t]*,[ \t]*[\w.]+(?:\s+as\s+\w+)?)*)|from\s+([\w.]+)\s+import)`)
 
-	for _, file := range files {
-		content, err := ioutil.ReadFile(file)
-		if err != nil {
-			continue
+// pythonImportsIn returns the absolute modules a .py file imports ("google.protobuf.json_format")
+func pythonImportsIn(_ string, content []byte) []string {
+	var modules []string
+	add := func(module string) {
+		module = strings.TrimSpace(strings.SplitN(strings.TrimSpace(module), " ", 2)[0]) // drop "as x"
+		if module != "" && !strings.HasPrefix(module, ".") {
+			modules = append(modules, module)
 		}
-
-		matches := importRegex.FindAllStringSubmatch(string(content), -1)
-		for _, m := range matches {
-			pkg := ""
-			if m[1] != "" {
-				pkg = m[1]
-			} else if m[2] != "" {
-				pkg = m[2]
-			}
-
-			if pkg != "" && !stdLib[pkg] {
-				deps[pkg] = true
+	}
+	for _, m := range pythonImportRegex.FindAllStringSubmatch(string(content), -1) {
+		if m[1] != "" {
+			for _, module := range strings.Split(m[1], ",") {
+				add(module)
 			}
+		} else if m[2] != "" {
+			add(m[2])
 		}
 	}
-
-	var result []string
-	for d := range deps {
-		result = append(result, d)
-	}
-	return result
+	return modules
 }
 
-func resolvePythonVersion(pkg string) string {
-	// Try pip show
-	cmd := exec.Command("pip", "show", pkg)
-	out, err := cmd.Output()
-	if err == nil {
-		lines := strings.Split(string(out), "\n")
-		for _, line := range lines {
-			if strings.HasPrefix(line, "Version: ") {
-				return strings.TrimSpace(strings.TrimPrefix(line, "Version: "))
-			}
+// pythonDependencies maps imported modules to the distributions to install,
+// skipping the standard library of the given version and the project's own modules
+func pythonDependencies(root string, files, modules []string, version string) []string {
+	local := localPythonModules(root, files)
+	minor := pythonMinorVersion(version)
+
+	deps := make(map[string]bool)
+	for _, module := range modules {
+		top := strings.SplitN(module, ".", 2)[0]
+		if top == "__future__" || isPythonStdlib(top, minor) || local[top] {
+			continue
 		}
+		deps[pythonDistribution(module)] = true
 	}
-	return "latest"
+	return sortedKeys(deps)
 }
@@ -0,0 +1,331 @@
+package create
+
+import (
+	"devsnap/pkg/metadata"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// devHost is the address dev servers bind to. Snapshots run on the developer's
+// machine, so nothing is exposed to the network unless the config says so.
+const devHost = "127.0.0.1"
+
+// framework is a web framework recognised by its dependencies or config files.
+// run returns the dev-server command ("" keeps the language detector's guess).
+type framework struct {
+	name    string
+	runtime string
+	port    int
+	detect  func(path string, deps map[string]bool) bool
+	run     func(path, prefix, host string, port int) string
+}
+
+// frameworks in order of precedence: meta-frameworks before the tools they build on (Nuxt uses Vite)
+var frameworks = []framework{
+	{"Angular", "node", 4200, hasFile("angular.json"), nil},
+	{"Next.js", "node", 3000, hasDepOrFile("next", "next.config.js", "next.config.mjs", "next.config.ts"),
+		func(_, prefix, host string, port int) string {
+			return fmt.Sprintf("%snext dev --hostname %s --port %d", prefix, host, port)
+		}},
+	{"Nuxt", "node", 3000, hasDepOrFile("nuxt", "nuxt.config.ts", "nuxt.config.js"),
+		func(_, prefix, host string, port int) string {
+			return fmt.Sprintf("%snuxt dev --host %s --port %d", prefix, host, port)
+		}},
+	{"Vite", "node", 5173, hasDepOrFile("vite", "vite.config.ts", "vite.config.js", "vite.config.mjs"),
+		func(_, prefix, host string, port int) string {
+			return fmt.Sprintf("%svite --host %s --port %d --strictPort", prefix, host, port)
+		}},
+
+	{"Django", "python", 8000, hasFile("manage.py"),
+		func(_, prefix, host string, port int) string {
+			return fmt.Sprintf("%spython manage.py runserver %s:%d", prefix, host, port)
+		}},
+	{"Streamlit", "python", 8501, hasDep("streamlit"),
+		func(path, prefix, host string, port int) string {
+			file, _ := findPythonApp(path, regexp.MustCompile(`(?m)^\s*(?:import|from)\s+streamlit\b()`))
+			if file == "" {
+				return ""
+			}
+			return fmt.Sprintf("%sstreamlit run %s --server.address %s --server.port %d", prefix, file, host, port)
+		}},
+	{"FastAPI", "python", 8000, hasDep("fastapi"),
+		func(path, prefix, host string, port int) string {
+			file, app := findPythonApp(path, regexp.MustCompile(`(?m)^(\w+)\s*=\s*FastAPI\(`))
+			if file == "" {
+				return ""
+			}
+			return fmt.Sprintf("%suvicorn %s:%s --host %s --port %d --reload", prefix, pythonModule(file), app, host, port)
+		}},
+	{"Flask", "python", 5000, hasDep("flask"),
+		func(path, prefix, host string, port int) string {
+			file, app := findPythonApp(path, regexp.MustCompile(`(?m)^(\w+)\s*=\s*Flask\(`))
+			if file == "" {
+				return ""
+			}
+			return fmt.Sprintf("%sflask --app %s:%s run --host %s --port %d", prefix, pythonModule(file), app, host, port)
+		}},
+
+	// Go servers bind where the code says; the port is read from the source when it is a literal
+	{"Gin", "go", 8080, hasDep("github.com/gin-gonic/gin"), nil},
+	{"Echo", "go", 1323, hasDep("github.com/labstack/echo/v4", "github.com/labstack/echo"), nil},
+
+	// The java detector already runs Spring Boot with its Maven plugin; the port comes from application.properties
+	{"Spring Boot", "java", 8080, hasDepPrefix("spring-boot"), nil},
+
+	{"Rails", "ruby", 3000, hasDepOrFile("rails", "bin/rails"),
+		func(_, _, host string, port int) string {
+			return fmt.Sprintf("bundle exec rails server -b %s -p %d", host, port)
+		}},
+
+	{"Laravel", "php", 8000, hasFile("artisan"),
+		func(_, _, host string, port int) string {
+			return fmt.Sprintf("php artisan serve --host=%s --port=%d", host, port)
+		}},
+}
+
+func hasFile(files ...string) func(string, map[string]bool) bool {
+	return func(path string, _ map[string]bool) bool {
+		for _, f := range files {
+			if exists(filepath.Join(path, f)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func hasDep(names ...string) func(string, map[string]bool) bool {
+	return func(_ string, deps map[string]bool) bool {
+		for _, n := range names {
+			if deps[n] {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func hasDepOrFile(dep string, files ...string) func(string, map[string]bool) bool {
+	return func(path string, deps map[string]bool) bool {
+		return deps[dep] || hasFile(files...)(path, deps)
+	}
+}
+
+func hasDepPrefix(prefix string) func(string, map[string]bool) bool {
+	return func(_ string, deps map[string]bool) bool {
+		for d := range deps {
+			if strings.HasPrefix(d, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// applyFramework sets the framework, dev-server command, port and host of an environment.
+// deps are the dependency names of the environment (nil reads them from its manifests).
+func applyFramework(path string, env *metadata.EnvironmentConfig, deps map[string]bool) {
+	runtime := runtimeOf(env.Type)
+	if runtime == "" {
+		return
+	}
+	if deps == nil {
+		deps = manifestDeps(path, runtime)
+	}
+
+	for _, fw := range frameworks {
+		if fw.runtime != runtime || !fw.detect(path, deps) {
+			continue
+		}
+		env.Framework = fw.name
+		env.Port = fw.port
+		if runtime == "java" {
+			if p := springPort(path); p != 0 {
+				env.Port = p
+			}
+			env.PortVar = "SERVER_PORT"
+		}
+		if runtime == "go" {
+			if p := goListenPort(path); p != 0 {
+				env.Port, env.PortFixed = p, true
+			}
+		}
+		if fw.run != nil && !hasRunScript(path, runtime) {
+			if run := fw.run(path, execPrefix(env), devHost, env.Port); run != "" {
+				env.Run = run
+				env.Host = devHost
+			}
+		}
+		fmt.Printf("   🧩 Framework: %s (port %d)\n", fw.name, env.Port)
+		return
+	}
+}
+
+// hasRunScript reports whether package.json has the project's own dev/start script.
+// It wins over the framework's command; start passes the port in PORT.
+func hasRunScript(path, runtime string) bool {
+	if runtime != "node" {
+		return false
+	}
+	pkg, err := readPackageJSON(path)
+	return err == nil && pkg.runScript() != ""
+}
+
+// nameSet turns Sherlock's dependency list into the set applyFramework expects
+func nameSet(runtime string, names []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, n := range names {
+		set[lockKey(runtime, n)] = true
+	}
+	return set
+}
+
+// execPrefix returns how the environment runs a tool installed by its package manager
+func execPrefix(env *metadata.EnvironmentConfig) string {
+	manager := strings.SplitN(env.PackageManager, "@", 2)[0]
+	switch runtimeOf(env.Type) {
+	case "node":
+		switch manager {
+		case PNPM:
+			return "pnpm exec "
+		case Yarn:
+			return "yarn "
+		case Bun:
+			return "bunx "
+		}
+		return "npx "
+	case "python":
+		switch manager {
+		case Poetry, UV, Pipenv:
+			return manager + " run "
+		case Conda:
+			// "conda run -n <name> python main.py" -> "conda run -n <name> "
+			if f := strings.Fields(env.Run); len(f) > 4 && f[0] == "conda" && f[2] == "-n" {
+				return strings.Join(f[:4], " ") + " "
+			}
+		}
+	}
+	return ""
+}
+
+// manifestDeps returns the dependency names a directory's manifests declare.
+// Python names are normalized with lockKey.
+func manifestDeps(path, runtime string) map[string]bool {
+	deps := make(map[string]bool)
+	read := func(file string) string {
+		content, _ := ioutil.ReadFile(filepath.Join(path, file))
+		return string(content)
+	}
+
+	switch runtime {
+	case "node":
+		if pkg, err := readPackageJSON(path); err == nil {
+			for _, m := range []map[string]string{pkg.Dependencies, pkg.DevDependencies, pkg.PeerDependencies, pkg.OptionalDependencies} {
+				for name := range m {
+					deps[name] = true
+				}
+			}
+		}
+
+	case "python":
+		var names []string
+		if py := readPyProject(path); py != nil {
+			names = append(names, py.Dependencies...)
+		}
+		pyproject := read("pyproject.toml")
+		names = append(names, tomlKeys(tomlSection(pyproject, "tool.poetry.dependencies"))...)
+		names = append(names, tomlKeys(tomlSection(read("Pipfile"), "packages"))...)
+		for _, line := range strings.Split(read("requirements.txt"), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "-") {
+				names = append(names, pythonRequirementName(line))
+			}
+		}
+		for _, n := range names {
+			deps[lockKey("python", n)] = true
+		}
+
+	case "go":
+		for _, m := range regexp.MustCompile(`(?m)^\s*(?:require\s+)?([a-zA-Z0-9][^\s()]*\.[^\s()]+)\s+v[0-9]`).FindAllStringSubmatch(read("go.mod"), -1) {
+			deps[m[1]] = true
+		}
+
+	case "java":
+		for _, m := range regexp.MustCompile(`<artifactId>\s*([^<\s]+)\s*</artifactId>`).FindAllStringSubmatch(read("pom.xml"), -1) {
+			deps[m[1]] = true
+		}
+
+	case "ruby":
+		for _, m := range regexp.MustCompile(`(?m)^\s*gem\s+["']([^"']+)["']`).FindAllStringSubmatch(read("Gemfile"), -1) {
+			deps[m[1]] = true
+		}
+	}
+	return deps
+}
+
+// pythonAppFiles are where Python web apps usually live, in order of preference
+var pythonAppFiles = []string{
+	"main.py", "app.py", "server.py", "api.py", "wsgi.py", "asgi.py", "streamlit_app.py", "Home.py",
+	"app/main.py", "app/__init__.py", "src/main.py", "src/app.py",
+}
+
+// findPythonApp returns the first candidate file matching re, and the first group of the match (the app variable)
+func findPythonApp(path string, re *regexp.Regexp) (file, app string) {
+	for _, f := range pythonAppFiles {
+		content, err := ioutil.ReadFile(filepath.Join(path, filepath.FromSlash(f)))
+		if err != nil {
+			continue
+		}
+		if m := re.FindSubmatch(content); m != nil {
+			return f, string(m[1])
+		}
+	}
+	return "", ""
+}
+
+// pythonModule turns a file into its import path ("app/main.py" -> "app.main", "app/__init__.py" -> "app")
+func pythonModule(file string) string {
+	module := strings.TrimSuffix(strings.TrimSuffix(file, ".py"), "/__init__")
+	return strings.ReplaceAll(module, "/", ".")
+}
+
+// goListenPort reads a literal listen address (r.Run(":8080"), e.Start(":1323"), http.ListenAndServe(":80", ...))
+func goListenPort(path string) int {
+	files, _ := filepath.Glob(filepath.Join(path, "*.go"))
+	re := regexp.MustCompile(`\.(?:Run|Start|ListenAndServe)\(\s*"[^":]*:([0-9]{2,5})"`)
+	for _, f := range files {
+		content, err := ioutil.ReadFile(f)
+		if err != nil {
+			continue
+		}
+		if m := re.FindSubmatch(content); m != nil {
+			port, _ := strconv.Atoi(string(m[1]))
+			return port
+		}
+	}
+	return 0
+}
+
+// springPort reads server.port from application.properties or application.yml
+func springPort(path string) int {
+	resources := filepath.Join(path, "src", "main", "resources")
+	properties := regexp.MustCompile(`(?m)^\s*server\.port\s*[=:]\s*([0-9]+)`)
+	yml := regexp.MustCompile(`(?m)^server:\s*\n(?:[ \t]+.*\n)*?[ \t]+port:\s*([0-9]+)`)
+	for _, c := range []struct {
+		file string
+		re   *regexp.Regexp
+	}{{"application.properties", properties}, {"application.yml", yml}, {"application.yaml", yml}} {
+		content, err := ioutil.ReadFile(filepath.Join(resources, c.file))
+		if err != nil {
+			continue
+		}
+		if m := c.re.FindSubmatch(content); m != nil {
+			port, _ := strconv.Atoi(string(m[1]))
+			return port
+		}
+	}
+	return 0
+}
@@ -0,0 +1,56 @@
+package create
+
+import (
+	"context"
+	"devsnap/pkg/metadata"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// gitTimeout bounds each git call; provenance is optional and must not stall create
+const gitTimeout = 5 * time.Second
+
+// GitProvenance returns the commit the project is checked out at, or nil if it isn't
+// in a git repository (or git is missing).
+func GitProvenance(root string) *metadata.GitProvenance {
+	commit := gitOutput(root, "rev-parse", "HEAD")
+	if commit == "" {
+		return nil
+	}
+	p := &metadata.GitProvenance{
+		Commit: commit,
+		Path:   gitOutput(root, "rev-parse", "--show-prefix"),
+		Remote: stripCredentials(gitOutput(root, "config", "--get", "remote.origin.url")),
+	}
+	if branch := gitOutput(root, "rev-parse", "--abbrev-ref", "HEAD"); branch != "HEAD" {
+		p.Branch = branch
+	}
+	// Untracked files count: they are archived too
+	p.Dirty = gitOutput(root, "status", "--porcelain", "--", ".") != ""
+	return p
+}
+
+// gitOutput runs git in dir and returns its trimmed output ("" on any failure)
+func gitOutput(dir string, args ...string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// stripCredentials drops a token or password from an https remote, which snapshots must not carry
+func stripCredentials(remote string) string {
+	u, err := url.Parse(remote)
+	if err != nil || u.User == nil || u.Scheme == "" {
+		return remote // scp-like "git@host:org/repo" has no secret
+	}
+	u.User = nil
+	return u.String()
+}
@@ -0,0 +1,182 @@
+package create
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// goImportsIn parses the import block of a .go file and returns its external import paths
+func goImportsIn(path string, content []byte) []string {
+	f, err := parser.ParseFile(token.NewFileSet(), path, content, parser.ImportsOnly)
+	if err != nil {
+		return nil
+	}
+	var imports []string
+	for _, imp := range f.Imports {
+		if p, err := strconv.Unquote(imp.Path.Value); err == nil && isExternalImport(p) {
+			imports = append(imports, p)
+		}
+	}
+	return imports
+}
+
+// goModules maps import paths to the modules that provide them.
+// cache is the module cache to look them up in ("" for none).
+func goModules(imports []string, cache string) []string {
+	modules := make(map[string]bool)
+	for _, imp := range imports {
+		modules[goModuleRoot(imp, cache)] = true
+	}
+	return sortedKeys(modules)
+}
+
+// isExternalImport reports whether an import path must be downloaded.
+// Like the go command, a path whose first element has no dot is not downloadable:
+// it's either the standard library (or cgo's "C") or a package of the project itself.
+func isExternalImport(path string) bool {
+	first := strings.SplitN(path, "/", 2)[0]
+	return strings.Contains(first, ".")
+}
+
+// goModuleRoot maps a package import path to the module that provides it.
+// The local module cache is authoritative; otherwise well-known hosting layouts are used.
+func goModuleRoot(importPath, cache string) string {
+	parts := strings.Split(importPath, "/")
+
+	// 1. Longest prefix the module cache knows about
+	if cache != "" {
+		for i := len(parts); i > 0; i-- {
+			prefix := strings.Join(parts[:i], "/")
+			if exists(filepath.Join(cache, "cache", "download", escapeModulePath(prefix), "@v")) {
+				return prefix
+			}
+		}
+	}
+
+	// 2. Hosting conventions
+	n := 3 // host/owner/repo
+	switch parts[0] {
+	case "gopkg.in":
+		// gopkg.in/yaml.v3 or gopkg.in/user/pkg.v1
+		n = 2
+		if len(parts) > 2 && !strings.Contains(parts[1], ".v") {
+			n = 3
+		}
+	case "google.golang.org", "k8s.io", "go.uber.org", "go.etcd.io", "go.opentelemetry.io", "cloud.google.com", "honnef.co":
+		n = 2
+	}
+	if n > len(parts) {
+		n = len(parts)
+	}
+	// Major version suffix belongs to the module path: github.com/x/y/v2/pkg -> github.com/x/y/v2
+	if len(parts) > n && regexp.MustCompile(`^v[2-9][0-9]*$`).MatchString(parts[n]) {
+		n++
+	}
+	return strings.Join(parts[:n], "/")
+}
+
+// goCachedVersion returns the highest version of a module already in the module cache ("" if none)
+func goCachedVersion(module, cache string) string {
+	if cache == "" {
+		return ""
+	}
+	infos, _ := filepath.Glob(filepath.Join(cache, "cache", "download", escapeModulePath(module), "@v", "*.info"))
+	best := ""
+	for _, info := range infos {
+		v := strings.TrimSuffix(filepath.Base(info), ".info")
+		if best == "" || compareSemver(v, best) > 0 {
+			best = v
+		}
+	}
+	return best
+}
+
+// goModCacheDir returns GOMODCACHE: from the environment, else `go env` (unless offline
+// or go is missing), else the default under GOPATH. "" if it can't be guessed.
+func (r *resolver) goModCacheDir() string {
+	r.goModCacheOnce.Do(func() {
+		if v := os.Getenv("GOMODCACHE"); v != "" {
+			r.goModCache = v
+			return
+		}
+		if !r.offline {
+			if out, err := r.run(r.root, "go", "env", "GOMODCACHE"); err == nil && strings.TrimSpace(string(out)) != "" {
+				r.goModCache = strings.TrimSpace(string(out))
+				return
+			}
+		}
+		gopath := os.Getenv("GOPATH")
+		if gopath == "" {
+			if home, err := os.UserHomeDir(); err == nil {
+				gopath = filepath.Join(home, "go")
+			}
+		}
+		if gopath != "" {
+			r.goModCache = filepath.Join(filepath.SplitList(gopath)[0], "pkg", "mod")
+		}
+	})
+	return r.goModCache
+}
+
+// escapeModulePath applies the module cache's case encoding ("github.com/Azure/x" -> "github.com/!azure/x")
+func escapeModulePath(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			b.WriteRune(unicode.ToLower(r))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return filepath.FromSlash(b.String())
+}
+
+// compareSemver compares two Go module versions (v1.2.3, v1.2.3-pre, pseudo-versions)
+func compareSemver(a, b string) int {
+	splitPre := func(v string) ([]string, string) {
+		v = strings.TrimPrefix(strings.SplitN(v, "+", 2)[0], "v")
+		pre := ""
+		if i := strings.Index(v, "-"); i != -1 {
+			v, pre = v[:i], v[i+1:]
+		}
+		return strings.Split(v, "."), pre
+	}
+
+	na, pa := splitPre(a)
+	nb, pb := splitPre(b)
+	for i := 0; i < 3; i++ {
+		var x, y int
+		if i < len(na) {
+			x, _ = strconv.Atoi(na[i])
+		}
+		if i < len(nb) {
+			y, _ = strconv.Atoi(nb[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	// A release sorts after its pre-releases
+	switch {
+	case pa == pb:
+		return 0
+	case pa == "":
+		return 1
+	case pb == "":
+		return -1
+	case pa < pb:
+		return -1
+	}
+	return 1
+}
@@ -0,0 +1,159 @@
+package create
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGoImportsIn(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name: "import block",
+			content: `package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	mux "github.com/gorilla/mux"
+	_ "github.com/lib/pq"
+	"example.com/app/internal/db"
+)
+
+func main() {}
+`,
+			want: []string{"github.com/gin-gonic/gin", "github.com/gorilla/mux", "github.com/lib/pq", "example.com/app/internal/db"},
+		},
+		{
+			name:    "single import",
+			content: "package main\n\nimport \"gopkg.in/yaml.v3\"\n",
+			want:    []string{"gopkg.in/yaml.v3"},
+		},
+		{
+			name:    "stdlib, cgo and project packages only",
+			content: "package main\n\n// #include <stdio.h>\nimport \"C\"\nimport (\n\t\"os\"\n\t\"myapp/config\"\n)\n",
+			want:    nil,
+		},
+		{
+			name:    "imports in comments and strings don't count",
+			content: "package main\n\n// import \"github.com/fake/comment\"\nvar s = `import \"github.com/fake/string\"`\n",
+			want:    nil,
+		},
+		{
+			name:    "not go",
+			content: "import requests\n",
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := goImportsIn("main.go", []byte(tt.content)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("goImportsIn() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoModuleRoot(t *testing.T) {
+	// A module cache that knows a module deeper than the hosting convention
+	cache := t.TempDir()
+	for _, module := range []string{"github.com/!azure/azure-sdk-for-go/sdk/azcore", "example.com/mono/tools"} {
+		if err := os.MkdirAll(filepath.Join(cache, "cache", "download", filepath.FromSlash(module), "@v"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		importPath string
+		cache      string
+		want       string
+	}{
+		{"github.com/gin-gonic/gin", "", "github.com/gin-gonic/gin"},
+		{"github.com/gin-gonic/gin/binding", "", "github.com/gin-gonic/gin"},
+		{"github.com/labstack/echo/v4", "", "github.com/labstack/echo/v4"},
+		{"github.com/labstack/echo/v4/middleware", "", "github.com/labstack/echo/v4"},
+		{"github.com/go-chi/chi/v5/middleware", "", "github.com/go-chi/chi/v5"},
+		{"gopkg.in/yaml.v3", "", "gopkg.in/yaml.v3"},
+		{"gopkg.in/src-d/go-git.v4/plumbing", "", "gopkg.in/src-d/go-git.v4"},
+		{"google.golang.org/grpc/codes", "", "google.golang.org/grpc"},
+		{"go.uber.org/zap/zapcore", "", "go.uber.org/zap"},
+		{"k8s.io/client-go/kubernetes", "", "k8s.io/client-go"},
+		{"golang.org/x/sync/errgroup", "", "golang.org/x/sync"},
+		{"example.com/tool", "", "example.com/tool"},
+
+		// The module cache wins over the conventions
+		{"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy", cache, "github.com/Azure/azure-sdk-for-go/sdk/azcore"},
+		{"example.com/mono/tools/lint", cache, "example.com/mono/tools"},
+		{"github.com/gin-gonic/gin/binding", cache, "github.com/gin-gonic/gin"},
+	}
+	for _, tt := range tests {
+		if got := goModuleRoot(tt.importPath, tt.cache); got != tt.want {
+			t.Errorf("goModuleRoot(%q) = %q, want %q", tt.importPath, got, tt.want)
+		}
+	}
+}
+
+func TestGoModules(t *testing.T) {
+	imports := []string{"github.com/gin-gonic/gin", "github.com/gin-gonic/gin/binding", "gopkg.in/yaml.v3", "github.com/google/uuid"}
+	want := []string{"github.com/gin-gonic/gin", "github.com/google/uuid", "gopkg.in/yaml.v3"}
+	if got := goModules(imports, ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("goModules() = %q, want %q", got, want)
+	}
+}
+
+func TestGoCachedVersion(t *testing.T) {
+	cache := t.TempDir()
+	versions := filepath.Join(cache, "cache", "download", "github.com", "!burnt!sushi", "toml", "@v")
+	if err := os.MkdirAll(versions, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"v1.2.0", "v1.10.0-rc.1", "v1.10.0", "v1.3.2"} {
+		if err := ioutil.WriteFile(filepath.Join(versions, v+".info"), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		module string
+		cache  string
+		want   string
+	}{
+		{"github.com/BurntSushi/toml", cache, "v1.10.0"},
+		{"github.com/google/uuid", cache, ""},
+		{"github.com/BurntSushi/toml", "", ""},
+	}
+	for _, tt := range tests {
+		if got := goCachedVersion(tt.module, tt.cache); got != tt.want {
+			t.Errorf("goCachedVersion(%q, %q) = %q, want %q", tt.module, tt.cache, got, tt.want)
+		}
+	}
+}
+
+func TestCompareSemver(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "v1.2.3", 0},
+		{"v1.2.3", "v1.2.4", -1},
+		{"v1.10.0", "v1.9.9", 1},
+		{"v2.0.0", "v1.99.99", 1},
+		{"v1.2.3", "v1.2.3-rc.1", 1},
+		{"v1.2.3-alpha", "v1.2.3-beta", -1},
+		{"v0.0.0-20240101000000-abcdef123456", "v0.0.0-20230101000000-abcdef123456", 1},
+		{"v1.2.3+incompatible", "v1.2.3", 0},
+	}
+	for _, tt := range tests {
+		if got := compareSemver(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareSemver(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package create
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pythonDistributions maps import names to the PyPI distribution that provides them,
+// for the (many) packages whose import name differs from the name you pip install.
+// Dotted keys match submodules, e.g. "google.protobuf"; the longest match wins.
+var pythonDistributions = map[string]string{
+	"apiclient":              "google-api-python-client",
+	"attr":                   "attrs",
+	"bs4":                    "beautifulsoup4",
+	"corsheaders":            "django-cors-headers",
+	"Crypto":                 "pycryptodome",
+	"Cryptodome":             "pycryptodomex",
+	"cv2":                    "opencv-python",
+	"dateutil":               "python-dateutil",
+	"decouple":               "python-decouple",
+	"discord":                "discord.py",
+	"dns":                    "dnspython",
+	"docx":                   "python-docx",
+	"dotenv":                 "python-dotenv",
+	"engineio":               "python-engineio",
+	"environ":                "django-environ",
+	"faiss":                  "faiss-cpu",
+	"fitz":                   "PyMuPDF",
+	"flask_cors":             "Flask-Cors",
+	"flask_login":            "Flask-Login",
+	"flask_migrate":          "Flask-Migrate",
+	"flask_sqlalchemy":       "Flask-SQLAlchemy",
+	"flask_wtf":              "Flask-WTF",
+	"gi":                     "PyGObject",
+	"git":                    "GitPython",
+	"github":                 "PyGithub",
+	"gitlab":                 "python-gitlab",
+	"google.cloud.bigquery":  "google-cloud-bigquery",
+	"google.cloud.firestore": "google-cloud-firestore",
+	"google.cloud.pubsub":    "google-cloud-pubsub",
+	"google.cloud.storage":   "google-cloud-storage",
+	"google.generativeai":    "google-generativeai",
+	"google.protobuf":        "protobuf",
+	"googleapiclient":        "google-api-python-client",
+	"igraph":                 "python-igraph",
+	"jose":                   "python-jose",
+	"jwt":                    "PyJWT",
+	"kafka":                  "kafka-python",
+	"ldap":                   "python-ldap",
+	"Levenshtein":            "python-Levenshtein",
+	"magic":                  "python-magic",
+	"markdown":               "Markdown",
+	"multipart":              "python-multipart",
+	"MySQLdb":                "mysqlclient",
+	"nacl":                   "PyNaCl",
+	"newspaper":              "newspaper3k",
+	"OpenGL":                 "PyOpenGL",
+	"OpenSSL":                "pyOpenSSL",
+	"PIL":                    "Pillow",
+	"pkg_resources":          "setuptools",
+	"pptx":                   "python-pptx",
+	"psycopg2":               "psycopg2-binary",
+	"pydantic_settings":      "pydantic-settings",
+	"rest_framework":         "djangorestframework",
+	"ruamel":                 "ruamel.yaml",
+	"serial":                 "pyserial",
+	"skimage":                "scikit-image",
+	"sklearn":                "scikit-learn",
+	"slugify":                "python-slugify",
+	"socketio":               "python-socketio",
+	"speech_recognition":     "SpeechRecognition",
+	"telegram":               "python-telegram-bot",
+	"umap":                   "umap-learn",
+	"usb":                    "pyusb",
+	"win32api":               "pywin32",
+	"win32con":               "pywin32",
+	"wx":                     "wxPython",
+	"yaml":                   "PyYAML",
+	"zmq":                    "pyzmq",
+}
+
+// pythonDistribution returns the PyPI distribution name for an import path ("google.protobuf.json_format")
+func pythonDistribution(module string) string {
+	parts := strings.Split(module, ".")
+	for i := len(parts); i > 0; i-- {
+		if dist, ok := pythonDistributions[strings.Join(parts[:i], ".")]; ok {
+			return dist
+		}
+	}
+	return parts[0]
+}
+
+// isPythonStdlib reports whether a top-level module ships with Python.
+// version is "major.minor" (e.g. "3.12"); empty means any supported version.
+func isPythonStdlib(name, version string) bool {
+	if !pythonStdlib[name] {
+		return false
+	}
+	if version == "" {
+		return true
+	}
+	if added, ok := pythonStdlibAdded[name]; ok && compareMinor(version, added) < 0 {
+		return false
+	}
+	if removed, ok := pythonStdlibRemoved[name]; ok && compareMinor(version, removed) >= 0 {
+		return false
+	}
+	return true
+}
+
+// pythonMinorVersion extracts "3.11" from constraints like ">=3.11", "^3.11", "3.11.4" or "~=3.11.0".
+// Returns "" if there is none.
+func pythonMinorVersion(constraint string) string {
+	m := regexp.MustCompile(`([0-9]+)\.([0-9]+)`).FindStringSubmatch(constraint)
+	if m == nil {
+		return ""
+	}
+	return m[1] + "." + m[2]
+}
+
+// compareMinor compares two "major.minor" versions
+func compareMinor(a, b string) int {
+	pa, pb := strings.SplitN(a, ".", 2), strings.SplitN(b, ".", 2)
+	for i := 0; i < 2; i++ {
+		var x, y int
+		if i < len(pa) {
+			x, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			y, _ = strconv.Atoi(pb[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// localPythonModules returns the names importable from the project itself:
+// every .py file and every directory on the way to one (packages and namespace packages)
+func localPythonModules(root string, files []string) map[string]bool {
+	local := make(map[string]bool)
+	for _, f := range files {
+		if !strings.HasSuffix(f, ".py") {
+			continue
+		}
+		rel, err := filepath.Rel(root, f)
+		if err != nil {
+			continue
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		for _, dir := range parts[:len(parts)-1] {
+			local[dir] = true
+		}
+		local[strings.TrimSuffix(parts[len(parts)-1], ".py")] = true
+	}
+	return local
+}
+
+// nodeBuiltins are the Node.js core modules (require('module').builtinModules, Node 20).
+// Subpaths like "fs/promises" are matched by their root.
+var nodeBuiltins = map[string]bool{
+	"assert": true, "async_hooks": true, "buffer": true, "child_process": true, "cluster": true,
+	"console": true, "constants": true, "crypto": true, "dgram": true, "diagnostics_channel": true,
+	"dns": true, "domain": true, "events": true, "fs": true, "http": true, "http2": true,
+	"https": true, "inspector": true, "module": true, "net": true, "os": true, "path": true,
+	"perf_hooks": true, "process": true, "punycode": true, "querystring": true, "readline": true,
+	"repl": true, "stream": true, "string_decoder": true, "sys": true, "timers": true, "tls": true,
+	"trace_events": true, "tty": true, "url": true, "util": true, "v8": true, "vm": true,
+	"wasi": true, "worker_threads": true, "zlib": true,
+}
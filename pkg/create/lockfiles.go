@@ -0,0 +1,336 @@
+package create
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// lockedDep is a dependency as resolved by a lockfile
+type lockedDep struct {
+	Version   string
+	Integrity string // Hash the package manager verifies downloads against ("sha512-...", "h1:...")
+	Dev       bool   // Only a development dependency
+}
+
+// lockReader parses one lockfile into name -> resolved dependency
+type lockReader struct {
+	file string
+	read func(content []byte) map[string]lockedDep
+}
+
+// lockfiles lists, per runtime, the lockfiles the detector reads.
+// Order matters: earlier files win when several pin the same package.
+var lockfiles = map[string][]lockReader{
+	"node": {
+		{"package-lock.json", readPackageLock},
+		{"pnpm-lock.yaml", readPnpmLock},
+		{"yarn.lock", readYarnLock},
+	},
+	"go": {
+		{"go.sum", readGoSum},
+	},
+	"python": {
+		{"poetry.lock", readTomlPackages},
+		{"uv.lock", readTomlPackages},
+		{"Pipfile.lock", readPipfileLock},
+	},
+	"rust": {
+		{"Cargo.lock", readTomlPackages},
+	},
+}
+
+// readLocks merges the lockfiles of a runtime found in dir.
+// Returns the pinned dependencies (keyed by lockKey) and the lockfiles that were read.
+func readLocks(dir, runtime string) (map[string]lockedDep, []string) {
+	locks := make(map[string]lockedDep)
+	var files []string
+	for _, lf := range lockfiles[runtime] {
+		content, err := ioutil.ReadFile(filepath.Join(dir, lf.file))
+		if err != nil {
+			continue
+		}
+		files = append(files, lf.file)
+		for name, dep := range lf.read(content) {
+			key := lockKey(runtime, name)
+			if _, ok := locks[key]; !ok && dep.Version != "" {
+				locks[key] = dep
+			}
+		}
+	}
+	return locks, files
+}
+
+// lockKey normalizes a package name for lookups; Python names are case and separator insensitive (PEP 503)
+func lockKey(runtime, name string) string {
+	if runtime == "python" {
+		return strings.ToLower(regexp.MustCompile(`[-_.]+`).ReplaceAllString(name, "-"))
+	}
+	return name
+}
+
+// resolveDeps pins each dependency from the lockfiles, then asks the resolver
+// for the rest in one batch. Returns the pinned set and the names left at "latest".
+func resolveDeps(names []string, runtime string, locks map[string]lockedDep, r *resolver) (map[string]lockedDep, []string) {
+	deps := make(map[string]lockedDep)
+	var missing []string
+	for _, name := range names {
+		if dep, ok := locks[lockKey(runtime, name)]; ok {
+			deps[name] = dep
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	resolved := r.lookup(runtime, missing)
+
+	var unpinned []string
+	for _, name := range names {
+		dep, ok := deps[name]
+		if !ok {
+			dep = lockedDep{Version: resolved[name]}
+		}
+		if dep.Version == "" || dep.Version == "latest" {
+			dep.Version = "latest"
+			unpinned = append(unpinned, name)
+		}
+		deps[name] = dep
+	}
+	return deps, unpinned
+}
+
+// readPackageLock reads the top-level packages of package-lock.json (lockfileVersion 1-3)
+func readPackageLock(content []byte) map[string]lockedDep {
+	var lock struct {
+		Packages map[string]struct {
+			Version   string `json:"version"`
+			Integrity string `json:"integrity"`
+			Dev       bool   `json:"dev"`
+		} `json:"packages"`
+		Dependencies map[string]struct {
+			Version   string `json:"version"`
+			Integrity string `json:"integrity"`
+			Dev       bool   `json:"dev"`
+		} `json:"dependencies"`
+	}
+	if json.Unmarshal(content, &lock) != nil {
+		return nil
+	}
+
+	deps := make(map[string]lockedDep)
+	for path, pkg := range lock.Packages {
+		name := strings.TrimPrefix(path, "node_modules/")
+		if name == path || strings.Contains(name, "/node_modules/") {
+			continue // The root project, a workspace member or a nested copy
+		}
+		deps[name] = lockedDep{Version: pkg.Version, Integrity: pkg.Integrity, Dev: pkg.Dev}
+	}
+	// lockfileVersion 1
+	for name, pkg := range lock.Dependencies {
+		if _, ok := deps[name]; !ok {
+			deps[name] = lockedDep{Version: pkg.Version, Integrity: pkg.Integrity, Dev: pkg.Dev}
+		}
+	}
+	return deps
+}
+
+// readYarnLock reads yarn.lock, both the classic format and Berry's YAML-like one.
+// When a package is locked at several versions the highest wins.
+func readYarnLock(content []byte) map[string]lockedDep {
+	deps := make(map[string]lockedDep)
+	var names []string
+	var current lockedDep
+
+	flush := func() {
+		for _, name := range names {
+			if prev, ok := deps[name]; !ok || compareSemver(current.Version, prev.Version) > 0 {
+				deps[name] = current
+			}
+		}
+		names, current = nil, lockedDep{}
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if !strings.HasPrefix(line, " ") {
+			// Block header: "a@^1.0.0", a@^1.1.0:
+			flush()
+			for _, spec := range strings.Split(strings.TrimSuffix(line, ":"), ",") {
+				spec = strings.Trim(strings.TrimSpace(spec), `"`)
+				if at := strings.LastIndex(spec, "@"); at > 0 {
+					names = append(names, spec[:at])
+				}
+			}
+			continue
+		}
+
+		fields := strings.Fields(strings.TrimSpace(line))
+		if len(fields) != 2 || len(names) == 0 {
+			continue
+		}
+		value := strings.Trim(fields[1], `"`)
+		switch strings.TrimSuffix(fields[0], ":") {
+		case "version":
+			current.Version = value
+		case "integrity", "checksum":
+			current.Integrity = value
+		}
+	}
+	flush()
+	delete(deps, "__metadata")
+	return deps
+}
+
+// readPnpmLock reads the direct dependencies of the root importer of pnpm-lock.yaml (v5-v9)
+func readPnpmLock(content []byte) map[string]lockedDep {
+	type depMap map[string]interface{} // v5: name: version, v6+: name: {specifier, version}
+	var lock struct {
+		Importers map[string]struct {
+			Dependencies    depMap `yaml:"dependencies"`
+			DevDependencies depMap `yaml:"devDependencies"`
+		} `yaml:"importers"`
+		Dependencies    depMap `yaml:"dependencies"`
+		DevDependencies depMap `yaml:"devDependencies"`
+		Packages        map[string]struct {
+			Resolution struct {
+				Integrity string `yaml:"integrity"`
+			} `yaml:"resolution"`
+		} `yaml:"packages"`
+	}
+	if yaml.Unmarshal(content, &lock) != nil {
+		return nil
+	}
+
+	runtime := []depMap{lock.Dependencies}
+	dev := []depMap{lock.DevDependencies}
+	if root, ok := lock.Importers["."]; ok {
+		runtime = append(runtime, root.Dependencies)
+		dev = append(dev, root.DevDependencies)
+	}
+
+	deps := make(map[string]lockedDep)
+	for i, m := range append(runtime, dev...) {
+		for name, v := range m {
+			version := ""
+			switch v := v.(type) {
+			case string:
+				version = v
+			case depMap: // yaml.v3 decodes nested mappings into the enclosing map type
+				version, _ = v["version"].(string)
+			}
+			// Strip peer suffixes: 1.2.3(react@18.2.0) or 1.2.3_react@18.2.0
+			if i := strings.IndexAny(version, "(_"); i != -1 {
+				version = version[:i]
+			}
+			if version == "" || strings.HasPrefix(version, "link:") {
+				continue
+			}
+
+			if _, ok := deps[name]; ok {
+				continue // Runtime wins over dev
+			}
+			dep := lockedDep{Version: version, Dev: i >= len(runtime)}
+			for _, key := range []string{name + "@" + version, "/" + name + "@" + version, "/" + name + "/" + version} {
+				for pkgKey, pkg := range lock.Packages {
+					if pkgKey == key || strings.HasPrefix(pkgKey, key+"(") || strings.HasPrefix(pkgKey, key+"_") {
+						dep.Integrity = pkg.Resolution.Integrity
+					}
+				}
+			}
+			deps[name] = dep
+		}
+	}
+	return deps
+}
+
+// readGoSum reads module versions and their h1: hashes from go.sum; the highest version wins
+func readGoSum(content []byte) map[string]lockedDep {
+	deps := make(map[string]lockedDep)
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || strings.HasSuffix(fields[1], "/go.mod") {
+			continue
+		}
+		if prev, ok := deps[fields[0]]; !ok || compareSemver(fields[1], prev.Version) > 0 {
+			deps[fields[0]] = lockedDep{Version: fields[1], Integrity: fields[2]}
+		}
+	}
+	// Modules only listed for their go.mod still pin a version
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || !strings.HasSuffix(fields[1], "/go.mod") {
+			continue
+		}
+		if _, ok := deps[fields[0]]; !ok {
+			deps[fields[0]] = lockedDep{Version: strings.TrimSuffix(fields[1], "/go.mod")}
+		}
+	}
+	return deps
+}
+
+// readTomlPackages reads the [[package]] tables shared by poetry.lock, uv.lock and Cargo.lock
+func readTomlPackages(content []byte) map[string]lockedDep {
+	deps := make(map[string]lockedDep)
+	field := func(block, key string) string {
+		m := regexp.MustCompile(`(?m)^` + key + `\s*=\s*"([^"]+)"`).FindStringSubmatch(block)
+		if m == nil {
+			return ""
+		}
+		return m[1]
+	}
+
+	blocks := regexp.MustCompile(`(?m)^\[\[package\]\]\s*$`).Split(string(content), -1)
+	for _, block := range blocks[1:] {
+		// The package's own keys come before its sub-tables ([package.dependencies], ...)
+		if next := regexp.MustCompile(`(?m)^\[`).FindStringIndex(block); next != nil {
+			block = block[:next[0]]
+		}
+		name := field(block, "name")
+		if name == "" {
+			continue
+		}
+		dep := lockedDep{Version: field(block, "version"), Integrity: field(block, "checksum")}
+		if dep.Integrity == "" {
+			// poetry: files = [{file = "...", hash = "sha256:..."}], uv: sdist = { ..., hash = "sha256:..." }
+			if m := regexp.MustCompile(`hash\s*=\s*"([^"]+)"`).FindStringSubmatch(block); m != nil {
+				dep.Integrity = m[1]
+			}
+		}
+		deps[name] = dep
+	}
+	return deps
+}
+
+// readPipfileLock reads the default and develop sections of Pipfile.lock
+func readPipfileLock(content []byte) map[string]lockedDep {
+	type section map[string]struct {
+		Version string   `json:"version"`
+		Hashes  []string `json:"hashes"`
+	}
+	var lock struct {
+		Default section `json:"default"`
+		Develop section `json:"develop"`
+	}
+	if json.Unmarshal(content, &lock) != nil {
+		return nil
+	}
+
+	deps := make(map[string]lockedDep)
+	for i, s := range []section{lock.Develop, lock.Default} {
+		for name, pkg := range s {
+			dep := lockedDep{Version: strings.TrimPrefix(pkg.Version, "=="), Dev: i == 0}
+			if len(pkg.Hashes) > 0 {
+				dep.Integrity = pkg.Hashes[0]
+			}
+			deps[name] = dep
+		}
+	}
+	return deps
+}
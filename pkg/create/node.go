@@ -0,0 +1,196 @@
+package create
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// packageJSON holds the package.json fields the detectors care about
+type packageJSON struct {
+	Name           string            `json:"name"`
+	Main           string            `json:"main"`
+	Bin            json.RawMessage   `json:"bin"`
+	Scripts        map[string]string `json:"scripts"`
+	PackageManager string            `json:"packageManager"`
+	Workspaces     json.RawMessage   `json:"workspaces"`
+	Engines        struct {
+		Node string `json:"node"`
+	} `json:"engines"`
+
+	Dependencies         map[string]string `json:"dependencies"`
+	DevDependencies      map[string]string `json:"devDependencies"`
+	PeerDependencies     map[string]string `json:"peerDependencies"`
+	OptionalDependencies map[string]string `json:"optionalDependencies"`
+}
+
+// runScripts are the package.json scripts that start a project, in order of preference
+var runScripts = []string{"dev", "start", "serve"}
+
+// readPackageJSON parses the package.json in path
+func readPackageJSON(path string) (*packageJSON, error) {
+	content, err := ioutil.ReadFile(filepath.Join(path, "package.json"))
+	if err != nil {
+		return nil, err
+	}
+	var pkg packageJSON
+	if err := json.Unmarshal(content, &pkg); err != nil {
+		return nil, err
+	}
+	return &pkg, nil
+}
+
+// runScript returns the first script of runScripts the package defines
+func (p *packageJSON) runScript() string {
+	for _, s := range runScripts {
+		if p.Scripts[s] != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// entrypoint returns the file "main" or "bin" points to
+func (p *packageJSON) entrypoint() string {
+	if p.Main != "" {
+		return p.Main
+	}
+	// "bin" is either "cli.js" or {"tool": "cli.js"}
+	var single string
+	if json.Unmarshal(p.Bin, &single) == nil && single != "" {
+		return single
+	}
+	var many map[string]string
+	if json.Unmarshal(p.Bin, &many) == nil {
+		// Prefer the command named after the package, else any (sorted for stable output)
+		if entry := many[p.Name]; entry != "" {
+			return entry
+		}
+		var names []string
+		for name := range many {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) > 0 {
+			return many[names[0]]
+		}
+	}
+	return ""
+}
+
+// declaredVersion returns the version range the package declares for a dependency
+func (p *packageJSON) declaredVersion(name string) string {
+	for _, deps := range []map[string]string{p.Dependencies, p.DevDependencies, p.PeerDependencies, p.OptionalDependencies} {
+		if v := deps[name]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// nodeRunCommand picks the run command: a start-like script, else the main/bin entrypoint
+func nodeRunCommand(path string, pkg *packageJSON, manager string) string {
+	if pkg != nil {
+		if script := pkg.runScript(); script != "" {
+			return nodeScriptCommand(manager, script)
+		}
+		if entry := pkg.entrypoint(); entry != "" {
+			return "node " + entry
+		}
+	}
+	if exists(filepath.Join(path, "index.js")) {
+		return "node index.js"
+	}
+	return ""
+}
+
+// Node package managers
+const (
+	NPM  = "npm"
+	Yarn = "yarn"
+	PNPM = "pnpm"
+	Bun  = "bun"
+)
+
+// nodeLockfiles maps each lockfile to the package manager that owns it, in order of precedence
+var nodeLockfiles = []struct {
+	file    string
+	manager string
+}{
+	{"bun.lockb", Bun},
+	{"bun.lock", Bun},
+	{"pnpm-lock.yaml", PNPM},
+	{"yarn.lock", Yarn},
+	{"package-lock.json", NPM},
+	{"npm-shrinkwrap.json", NPM},
+}
+
+// detectNodePackageManager picks the package manager for the package.json in path.
+// The "packageManager" field (corepack, e.g. "pnpm@8.6.0") wins over lockfiles.
+// Returns the manager name, the full spec (name@version, or just the name) and whether a lockfile exists.
+func detectNodePackageManager(path string) (manager, spec string, locked bool) {
+	for _, lf := range nodeLockfiles {
+		if exists(filepath.Join(path, lf.file)) {
+			manager, locked = lf.manager, true
+			break
+		}
+	}
+
+	if pkg, err := readPackageJSON(path); err == nil && pkg.PackageManager != "" {
+		// "yarn@3.6.1+sha224.abc" -> spec "yarn@3.6.1"
+		spec = strings.SplitN(pkg.PackageManager, "+", 2)[0]
+		declared := strings.SplitN(spec, "@", 2)[0]
+		if declared != manager {
+			// A lockfile from another manager can't be honoured by this one
+			locked = false
+		}
+		return declared, spec, locked
+	}
+
+	if manager == "" {
+		manager = NPM
+	}
+	return manager, manager, locked
+}
+
+// nodeInstallCommand returns the install command, frozen to the lockfile when there is one
+func nodeInstallCommand(path, manager, spec string, locked bool) string {
+	if !locked {
+		return manager + " install"
+	}
+	switch manager {
+	case Yarn:
+		// Yarn 2+ (berry) renamed --frozen-lockfile to --immutable
+		if isYarnBerry(path, spec) {
+			return "yarn install --immutable"
+		}
+		return "yarn install --frozen-lockfile"
+	case PNPM:
+		return "pnpm install --frozen-lockfile"
+	case Bun:
+		return "bun install --frozen-lockfile"
+	default:
+		return "npm ci"
+	}
+}
+
+// nodeScriptCommand returns the command that runs a package.json script with the given manager
+func nodeScriptCommand(manager, script string) string {
+	if manager == NPM && script != "start" && script != "test" {
+		return "npm run " + script
+	}
+	if manager == Bun {
+		return "bun run " + script
+	}
+	return manager + " " + script
+}
+
+func isYarnBerry(path, spec string) bool {
+	if exists(filepath.Join(path, ".yarnrc.yml")) {
+		return true
+	}
+	parts := strings.SplitN(spec, "@", 2)
+	return len(parts) == 2 && !strings.HasPrefix(parts[1], "1.")
+}
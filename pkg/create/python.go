@@ -0,0 +1,239 @@
+package create
+
+import (
+	"devsnap/pkg/metadata"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Python package managers
+const (
+	Pip    = "pip"
+	Poetry = "poetry"
+	Pipenv = "pipenv"
+	UV     = "uv"
+	Conda  = "conda"
+)
+
+// pyProject holds the pyproject.toml fields the detector cares about
+type pyProject struct {
+	RequiresPython string
+	Dependencies   []string
+	Scripts        []string // Console scripts from [project.scripts] / [tool.poetry.scripts]
+	Poetry         bool     // Has a [tool.poetry] table
+	Installable    bool     // Has a [project] or [build-system] table (not just tool settings)
+}
+
+// detectPython checks a directory for Python manifests, from the most to the least specific tool.
+// Returns nil if the directory isn't a Python project.
+func detectPython(path string) *metadata.EnvironmentConfig {
+	py := readPyProject(path)
+
+	env := &metadata.EnvironmentConfig{Type: "python", Version: ">=3.9"}
+	if py != nil && py.RequiresPython != "" {
+		env.Version, env.VersionSource = py.RequiresPython, "pyproject.toml"
+	}
+
+	switch {
+	case exists(filepath.Join(path, "environment.yml")) || exists(filepath.Join(path, "environment.yaml")):
+		file := "environment.yml"
+		if !exists(filepath.Join(path, file)) {
+			file = "environment.yaml"
+		}
+		name, version := readCondaEnv(filepath.Join(path, file))
+		if version != "" {
+			env.Version, env.VersionSource = version, file
+		}
+		env.PackageManager = Conda
+		env.Setup = []string{"conda env create -f " + file}
+		if name != "" {
+			env.Run = fmt.Sprintf("conda run -n %s %s", name, pythonEntrypoint(path, py, ""))
+		} else {
+			env.Run = pythonEntrypoint(path, py, "")
+		}
+
+	case exists(filepath.Join(path, "uv.lock")):
+		env.PackageManager = UV
+		env.Setup = []string{"uv sync --frozen"}
+		env.Run = pythonEntrypoint(path, py, "uv run ")
+
+	case exists(filepath.Join(path, "poetry.lock")) || (py != nil && py.Poetry):
+		env.PackageManager = Poetry
+		env.Setup = []string{"poetry install"}
+		env.Run = pythonEntrypoint(path, py, "poetry run ")
+		if v := readPoetryPython(path); v != "" && env.VersionSource == "" {
+			env.Version, env.VersionSource = v, "pyproject.toml"
+		}
+
+	case exists(filepath.Join(path, "Pipfile")):
+		env.PackageManager = Pipenv
+		if exists(filepath.Join(path, "Pipfile.lock")) {
+			env.Setup = []string{"pipenv sync"}
+		} else {
+			env.Setup = []string{"pipenv install"}
+		}
+		env.Run = pythonEntrypoint(path, py, "pipenv run ")
+		if v := readPipfilePython(path); v != "" {
+			env.Version, env.VersionSource = v, "Pipfile"
+		}
+
+	case py != nil && py.Installable:
+		// Plain PEP 621 project, installable with pip
+		env.PackageManager = Pip
+		env.Setup = []string{"pip install -e ."}
+		env.Run = pythonEntrypoint(path, py, "")
+
+	case exists(filepath.Join(path, "requirements.txt")):
+		env.PackageManager = Pip
+		env.Setup = []string{"pip install -r requirements.txt"}
+		env.Run = pythonEntrypoint(path, py, "")
+
+	default:
+		return nil
+	}
+
+	if py != nil && len(py.Dependencies) > 0 {
+		fmt.Printf("   🐍 pyproject.toml: %d dependencies (%s)\n", len(py.Dependencies), summarizeDeps(py.Dependencies))
+	}
+	return env
+}
+
+// pythonEntrypoint picks the run command: a declared console script, else a well-known entry file.
+// prefix runs the command inside the tool's environment (e.g. "poetry run ").
+func pythonEntrypoint(path string, py *pyProject, prefix string) string {
+	if py != nil && len(py.Scripts) > 0 {
+		return prefix + py.Scripts[0]
+	}
+	if !exists(filepath.Join(path, "main.py")) && exists(filepath.Join(path, "app.py")) {
+		return prefix + "python app.py"
+	}
+	return prefix + "python main.py"
+}
+
+// readPyProject parses the parts of pyproject.toml we need. Returns nil if there is none.
+func readPyProject(path string) *pyProject {
+	content, err := ioutil.ReadFile(filepath.Join(path, "pyproject.toml"))
+	if err != nil {
+		return nil
+	}
+	str := string(content)
+
+	py := &pyProject{}
+	project := tomlSection(str, "project")
+	if m := regexp.MustCompile(`(?m)^\s*requires-python\s*=\s*"([^"]+)"`).FindStringSubmatch(project); m != nil {
+		py.RequiresPython = m[1]
+	}
+	for _, dep := range tomlArray(project, "dependencies") {
+		py.Dependencies = append(py.Dependencies, pythonRequirementName(dep))
+	}
+
+	py.Scripts = append(py.Scripts, tomlKeys(tomlSection(str, "project.scripts"))...)
+	py.Scripts = append(py.Scripts, tomlKeys(tomlSection(str, "tool.poetry.scripts"))...)
+	py.Poetry = regexp.MustCompile(`(?m)^\s*\[tool\.poetry\]`).MatchString(str)
+	py.Installable = regexp.MustCompile(`(?m)^\s*\[(project|build-system)\]`).MatchString(str)
+	return py
+}
+
+// readPoetryPython reads python = "^3.11" from [tool.poetry.dependencies]
+func readPoetryPython(path string) string {
+	content, err := ioutil.ReadFile(filepath.Join(path, "pyproject.toml"))
+	if err != nil {
+		return ""
+	}
+	deps := tomlSection(string(content), "tool.poetry.dependencies")
+	if m := regexp.MustCompile(`(?m)^\s*python\s*=\s*"([^"]+)"`).FindStringSubmatch(deps); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// readPipfilePython reads python_version from the [requires] table of a Pipfile
+func readPipfilePython(path string) string {
+	content, err := ioutil.ReadFile(filepath.Join(path, "Pipfile"))
+	if err != nil {
+		return ""
+	}
+	requires := tomlSection(string(content), "requires")
+	if m := regexp.MustCompile(`(?m)^\s*python_(?:full_)?version\s*=\s*"([^"]+)"`).FindStringSubmatch(requires); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// readCondaEnv returns the environment name and the pinned python version of a conda environment file
+func readCondaEnv(file string) (name, pythonVersion string) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", ""
+	}
+	var env struct {
+		Name         string        `yaml:"name"`
+		Dependencies []interface{} `yaml:"dependencies"` // strings, or {pip: [...]}
+	}
+	if yaml.Unmarshal(content, &env) != nil {
+		return "", ""
+	}
+	for _, d := range env.Dependencies {
+		if s, ok := d.(string); ok && (s == "python" || strings.HasPrefix(s, "python=") || strings.HasPrefix(s, "python>") || strings.HasPrefix(s, "python<")) {
+			pythonVersion = strings.TrimLeft(strings.TrimPrefix(s, "python"), "=")
+		}
+	}
+	return env.Name, pythonVersion
+}
+
+// pythonRequirementName strips extras, versions and markers: "uvicorn[standard]>=0.20; python_version>'3.8'" -> "uvicorn"
+func pythonRequirementName(req string) string {
+	end := strings.IndexAny(req, "[<>=!~;@ ")
+	if end == -1 {
+		return strings.TrimSpace(req)
+	}
+	return strings.TrimSpace(req[:end])
+}
+
+// tomlArray returns the string items of key = [ ... ] in a TOML table body.
+// Quotes are respected so "pkg[extra]" doesn't end the array early.
+func tomlArray(section, key string) []string {
+	loc := regexp.MustCompile(`(?m)^\s*` + regexp.QuoteMeta(key) + `\s*=\s*\[`).FindStringIndex(section)
+	if loc == nil {
+		return nil
+	}
+
+	var items []string
+	var current strings.Builder
+	var quote byte
+	for i := loc[1]; i < len(section); i++ {
+		c := section[i]
+		switch {
+		case quote != 0 && c == quote:
+			items = append(items, current.String())
+			current.Reset()
+			quote = 0
+		case quote != 0:
+			current.WriteByte(c)
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			// Comment until end of line
+			for i < len(section) && section[i] != '\n' {
+				i++
+			}
+		case c == ']':
+			return items
+		}
+	}
+	return items
+}
+
+// tomlKeys returns the keys of a TOML table body, in file order
+func tomlKeys(section string) []string {
+	var keys []string
+	for _, m := range regexp.MustCompile(`(?m)^\s*"?([A-Za-z0-9_.\-]+)"?\s*=`).FindAllStringSubmatch(section, -1) {
+		keys = append(keys, m[1])
+	}
+	return keys
+}
@@ -0,0 +1,139 @@
+package create
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeFiles writes files (slash-separated paths) under dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDetectPython(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  *pythonEnv // nil: not a Python project
+	}{
+		{
+			name:  "requirements.txt",
+			files: map[string]string{"requirements.txt": "flask==3.0.0\n", "main.py": ""},
+			want:  &pythonEnv{Pip, ">=3.9", "", "pip install -r requirements.txt", "python main.py"},
+		},
+		{
+			name:  "app.py entrypoint",
+			files: map[string]string{"requirements.txt": "", "app.py": ""},
+			want:  &pythonEnv{Pip, ">=3.9", "", "pip install -r requirements.txt", "python app.py"},
+		},
+		{
+			name: "PEP 621 project",
+			files: map[string]string{
+				"pyproject.toml":   "[project]\nname = \"app\"\nrequires-python = \">=3.11\"\ndependencies = [\"httpx\"]\n\n[project.scripts]\napp = \"app.cli:main\"\n",
+				"requirements.txt": "httpx\n",
+			},
+			want: &pythonEnv{Pip, ">=3.11", "pyproject.toml", "pip install -e .", "app"},
+		},
+		{
+			name:  "build-system only",
+			files: map[string]string{"pyproject.toml": "[build-system]\nrequires = [\"setuptools\"]\n"},
+			want:  &pythonEnv{Pip, ">=3.9", "", "pip install -e .", "python main.py"},
+		},
+		{
+			name: "tool settings only fall back to requirements.txt",
+			files: map[string]string{
+				"pyproject.toml":   "[tool.black]\nline-length = 100\n\n[tool.ruff]\nselect = [\"E\"]\n",
+				"requirements.txt": "django\n",
+			},
+			want: &pythonEnv{Pip, ">=3.9", "", "pip install -r requirements.txt", "python main.py"},
+		},
+		{
+			name:  "tool settings only",
+			files: map[string]string{"pyproject.toml": "[tool.black]\nline-length = 100\n"},
+			want:  nil,
+		},
+		{
+			name: "poetry",
+			files: map[string]string{
+				"pyproject.toml": "[tool.poetry]\nname = \"app\"\n\n[tool.poetry.dependencies]\npython = \"^3.12\"\n\n[tool.poetry.scripts]\nserve = \"app:serve\"\n",
+				"poetry.lock":    "",
+			},
+			want: &pythonEnv{Poetry, "^3.12", "pyproject.toml", "poetry install", "poetry run serve"},
+		},
+		{
+			name:  "uv",
+			files: map[string]string{"pyproject.toml": "[project]\nname = \"app\"\n", "uv.lock": ""},
+			want:  &pythonEnv{UV, ">=3.9", "", "uv sync --frozen", "uv run python main.py"},
+		},
+		{
+			name:  "pipenv with a lockfile",
+			files: map[string]string{"Pipfile": "[packages]\nrequests = \"*\"\n\n[requires]\npython_version = \"3.10\"\n", "Pipfile.lock": "{}"},
+			want:  &pythonEnv{Pipenv, "3.10", "Pipfile", "pipenv sync", "pipenv run python main.py"},
+		},
+		{
+			name:  "pipenv without a lockfile",
+			files: map[string]string{"Pipfile": "[packages]\nrequests = \"*\"\n"},
+			want:  &pythonEnv{Pipenv, ">=3.9", "", "pipenv install", "pipenv run python main.py"},
+		},
+		{
+			name:  "conda",
+			files: map[string]string{"environment.yml": "name: science\ndependencies:\n  - python=3.11\n  - numpy\n  - pip:\n    - requests\n"},
+			want:  &pythonEnv{Conda, "3.11", "environment.yml", "conda env create -f environment.yml", "conda run -n science python main.py"},
+		},
+		{
+			name:  "no manifest",
+			files: map[string]string{"main.py": "print('hi')\n"},
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+
+			env := detectPython(dir)
+			var got *pythonEnv
+			if env != nil {
+				if len(env.Setup) != 1 {
+					t.Fatalf("setup = %q, want one step", env.Setup)
+				}
+				got = &pythonEnv{env.PackageManager, env.Version, env.VersionSource, env.Setup[0], env.Run}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("detectPython() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// pythonEnv is the part of a detected environment the Python detector decides
+type pythonEnv struct {
+	manager, version, versionSource, setup, run string
+}
+
+func TestPythonRequirementName(t *testing.T) {
+	tests := map[string]string{
+		"requests":                          "requests",
+		"Django>=4.2,<5":                    "Django",
+		"uvicorn[standard]>=0.20":           "uvicorn",
+		"black ; python_version>'3.8'":      "black",
+		"pkg @ https://example.com/pkg.whl": "pkg",
+	}
+	for req, want := range tests {
+		if got := pythonRequirementName(req); got != want {
+			t.Errorf("pythonRequirementName(%q) = %q, want %q", req, got, want)
+		}
+	}
+}
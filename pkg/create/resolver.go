@@ -0,0 +1,266 @@
+package create
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// resolveTimeout bounds each external tool call (npm ls, pip list, go list)
+const resolveTimeout = 20 * time.Second
+
+// resolveCacheTTL expires cached versions; "latest" lookups go stale even if no lockfile changes
+const resolveCacheTTL = 24 * time.Hour
+
+// resolver finds the versions lockfiles don't pin. It makes at most one batched tool
+// call per ecosystem and caches the answers on disk, keyed by project and lockfile hash.
+type resolver struct {
+	root    string
+	offline bool // Never run external tools
+
+	goModCacheOnce sync.Once
+	goModCache     string
+}
+
+func newResolver(root string, offline bool) *resolver {
+	return &resolver{root: root, offline: offline}
+}
+
+// resolverCache is the on-disk cache of one project and runtime
+type resolverCache struct {
+	Created  time.Time         `json:"created"`
+	Versions map[string]string `json:"versions"` // lockKey -> version
+}
+
+// lookup returns the versions it could find, keyed by the names asked for
+func (r *resolver) lookup(runtime string, names []string) map[string]string {
+	found := make(map[string]string)
+	if len(names) == 0 {
+		return found
+	}
+
+	cachePath := r.cachePath(runtime)
+	cache := loadResolverCache(cachePath)
+
+	var missing []string
+	for _, name := range names {
+		if v, ok := cache.Versions[lockKey(runtime, name)]; ok {
+			found[name] = v
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return found
+	}
+
+	var fresh map[string]string
+	switch runtime {
+	case "node":
+		fresh = r.nodeVersions(missing)
+	case "python":
+		fresh = r.pythonVersions()
+	case "go":
+		fresh = r.goVersions(missing)
+	}
+
+	added := false
+	for _, name := range missing {
+		if v, ok := fresh[lockKey(runtime, name)]; ok && v != "" {
+			found[name] = v
+			cache.Versions[lockKey(runtime, name)] = v
+			added = true
+		}
+	}
+	if added && cachePath != "" {
+		saveResolverCache(cachePath, cache)
+	}
+	return found
+}
+
+// nodeVersions reads what is installed in node_modules: one `npm ls`, or the package files when offline
+func (r *resolver) nodeVersions(names []string) map[string]string {
+	versions := make(map[string]string)
+	if !r.offline {
+		// npm ls exits non-zero for extraneous packages (always the case without package.json) but still prints the tree
+		out, _ := r.run(r.root, "npm", "ls", "--json", "--depth=0")
+		var tree struct {
+			Dependencies map[string]struct {
+				Version string `json:"version"`
+			} `json:"dependencies"`
+		}
+		if json.Unmarshal(out, &tree) == nil {
+			for name, dep := range tree.Dependencies {
+				versions[name] = dep.Version
+			}
+			return versions
+		}
+	}
+
+	for _, name := range names {
+		content, err := ioutil.ReadFile(filepath.Join(r.root, "node_modules", name, "package.json"))
+		if err != nil {
+			continue
+		}
+		var pkg struct {
+			Version string `json:"version"`
+		}
+		if json.Unmarshal(content, &pkg) == nil {
+			versions[name] = pkg.Version
+		}
+	}
+	return versions
+}
+
+// pythonVersions lists the distributions installed in the active interpreter with one `pip list`
+func (r *resolver) pythonVersions() map[string]string {
+	versions := make(map[string]string)
+	if r.offline {
+		return versions
+	}
+	out, err := r.run(r.root, "pip", "list", "--format", "json", "--disable-pip-version-check")
+	if err != nil {
+		return versions
+	}
+	var installed []struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	if json.Unmarshal(out, &installed) == nil {
+		for _, d := range installed {
+			versions[lockKey("python", d.Name)] = d.Version
+		}
+	}
+	return versions
+}
+
+// goVersions checks the local module cache, then asks the go command once:
+// `go list -m all` inside a module, else one query with every module@latest.
+func (r *resolver) goVersions(modules []string) map[string]string {
+	versions := make(map[string]string)
+	var remaining []string
+	for _, m := range modules {
+		if v := goCachedVersion(m, r.goModCacheDir()); v != "" {
+			versions[m] = v
+		} else {
+			remaining = append(remaining, m)
+		}
+	}
+	if r.offline || len(remaining) == 0 {
+		return versions
+	}
+
+	args := []string{"list", "-m", "-e", "-json"}
+	dir := r.root
+	if _, err := os.Stat(filepath.Join(r.root, "go.mod")); err == nil {
+		args = append(args, "all")
+	} else {
+		for _, m := range remaining {
+			args = append(args, m+"@latest")
+		}
+		dir = os.TempDir() // Outside any module, so the query isn't tied to the project
+	}
+
+	out, err := r.run(dir, "go", args...)
+	if err != nil && len(out) == 0 {
+		return versions
+	}
+	// go list -json prints a stream of objects
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var mod struct {
+			Path    string `json:"Path"`
+			Version string `json:"Version"`
+		}
+		if err := dec.Decode(&mod); err == io.EOF || err != nil {
+			break
+		}
+		if _, ok := versions[mod.Path]; !ok && mod.Version != "" {
+			versions[mod.Path] = mod.Version
+		}
+	}
+	return versions
+}
+
+// run executes a tool with resolveTimeout and returns its stdout
+func (r *resolver) run(dir, name string, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		fmt.Printf("   ⏱️  %s %s timed out after %s, skipping\n", name, args[0], resolveTimeout)
+		return nil, ctx.Err()
+	}
+	return out, err
+}
+
+// cachePath returns the cache file for a runtime of this project ("" if there is no cache dir).
+// The key covers the project path and the lockfiles, so a changed lockfile starts over.
+func (r *resolver) cachePath(runtime string) string {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	abs, err := filepath.Abs(r.root)
+	if err != nil {
+		abs = r.root
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", abs, runtime)
+	inputs := []string{}
+	for _, lf := range lockfiles[runtime] {
+		inputs = append(inputs, lf.file)
+	}
+	if runtime == "node" {
+		inputs = append(inputs, "package.json", filepath.Join("node_modules", ".package-lock.json")) // npm rewrites the latter on every install
+	}
+	for _, file := range inputs {
+		if content, err := ioutil.ReadFile(filepath.Join(r.root, file)); err == nil {
+			fmt.Fprintf(h, "%s\x00", file)
+			h.Write(content)
+		}
+	}
+	return filepath.Join(base, "devsnap", "versions", hex.EncodeToString(h.Sum(nil))[:32]+".json")
+}
+
+func loadResolverCache(path string) *resolverCache {
+	cache := &resolverCache{Created: time.Now(), Versions: make(map[string]string)}
+	if path == "" {
+		return cache
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	var stored resolverCache
+	if json.Unmarshal(content, &stored) != nil || time.Since(stored.Created) > resolveCacheTTL || stored.Versions == nil {
+		return cache
+	}
+	return &stored
+}
+
+func saveResolverCache(path string, cache *resolverCache) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	if content, err := json.Marshal(cache); err == nil {
+		ioutil.WriteFile(path, content, 0644)
+	}
+}
@@ -1,9 +1,14 @@
 package create
 
 import (
-	"os"
+	"context"
+	"devsnap/pkg/config"
+	"io/fs"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 )
 
 // DefaultIgnores is a list of patterns/directories to always ignore
@@ -11,34 +16,120 @@ var DefaultIgnores = map[string]bool{
 	".git":         true,
 	"node_modules": true,
 	"__pycache__":  true,
-	".devsnap":     true,
+	".venv":        true, // Recreated in the sandbox by start
+	"venv":         true,
+	".devsnap":     true, // metadata.GeneratedDir, reserved for generated archive entries
 	".env":         true, // Security: don't snapshot secrets by default
 	"dist":         true,
 	"build":        true,
+	"target":       true, // Rust/Maven build output
 }
 
-// ScanDirectory walks the given path and returns a list of files to include
-func ScanDirectory(root string) ([]string, error) {
-	var files []string
+// analysisIgnores are archived but not analyzed: third-party code whose imports aren't the project's
+var analysisIgnores = map[string]bool{
+	"vendor": true,
+}
+
+// Analysis is what a single walk over the project found
+type Analysis struct {
+	Root string
+
+	// Files to archive (absolute paths, walk order)
+	Files []string
+
+	// Dirs that may hold manifests: slash-separated, relative to Root, parents before children ("." first)
+	Dirs []string
+
+	// CodeFiles are the sources the analyzers read (walk order)
+	CodeFiles []string
+
+	EnvVars       []string // Variables the code reads (process.env.X, os.Getenv("X"), ...)
+	NodeImports   []string // Package names, without local files and core modules
+	PythonImports []string // Dotted module paths, without relative imports
+	GoImports     []string // External import paths
+	GoTestImports []string // External import paths of _test.go files
+}
+
+// ScanProject walks the project once. The walk applies the ignore rules (DefaultIgnores,
+// then the project config) and feeds every code file to a pool of analyzers while it goes.
+// Cancelling ctx stops the walk and the workers.
+func ScanProject(ctx context.Context, root string, cfg *config.ProjectConfig) (*Analysis, error) {
+	a := &Analysis{Root: root}
+	cache := newFileCache()
+	jobs := make(chan analysisJob, 256)
+
+	var mu sync.Mutex
+	buckets := make(map[string]map[string]bool)
+	for _, an := range analyzers {
+		buckets[an.bucket] = make(map[string]bool)
+	}
 
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if ctx.Err() != nil {
+					cache.done(job.path)
+					continue // Drain
+				}
+				content, err := cache.get(job.path)
+				var found []string
+				if err == nil {
+					found = job.an.run(job.path, content)
+				}
+				cache.done(job.path)
+
+				mu.Lock()
+				for _, f := range found {
+					buckets[job.an.bucket][f] = true
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	walkErr := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-		// Get relative path for checking against ignores
 		relPath, err := filepath.Rel(root, path)
 		if err != nil {
 			return err
 		}
+		if relPath == "." {
+			a.Dirs = append(a.Dirs, ".")
+			return nil
+		}
 
-		// Normalize path separators for consistent checking
-		parts := strings.Split(filepath.ToSlash(relPath), "/")
+		// Explicit excludes win over everything
+		if cfg.Excludes(relPath) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
 
 		// Check if any part of the path is in the ignore list
-		for _, part := range parts {
+		analyzed := true
+		for _, part := range strings.Split(filepath.ToSlash(relPath), "/") {
+			if DefaultIgnores[part] && part != ".env" && part != ".devsnap" && cfg.Includes(relPath) {
+				// Explicitly included (never .env, secrets stay out; .devsnap is reserved for generated files).
+				// Archived, but it's not the project's own code.
+				analyzed = false
+				break
+			}
 			if DefaultIgnores[part] {
-				if info.IsDir() {
+				if d.IsDir() && cfg != nil && config.CouldMatchUnder(cfg.Include, relPath) {
+					// Keep walking, an include pattern points inside
+					return nil
+				}
+				if d.IsDir() {
 					return filepath.SkipDir
 				}
 				return nil
@@ -47,15 +138,66 @@ func ScanDirectory(root string) ([]string, error) {
 			if strings.HasSuffix(part, ".devsnap") {
 				return nil
 			}
+			if analysisIgnores[part] {
+				analyzed = false
+			}
 		}
 
-		// Don't add directories to the file list, only files
-		if !info.IsDir() {
-			files = append(files, path)
+		if d.IsDir() {
+			if analyzed {
+				a.Dirs = append(a.Dirs, filepath.ToSlash(relPath))
+			}
+			return nil
 		}
 
+		a.Files = append(a.Files, path)
+		if !analyzed || !isCodeFile(path) {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() > maxAnalyzedSize {
+			return nil
+		}
+		a.CodeFiles = append(a.CodeFiles, path)
+
+		var matching []*analyzer
+		for i := range analyzers {
+			if analyzers[i].match(path) {
+				matching = append(matching, &analyzers[i])
+			}
+		}
+		cache.expect(path, len(matching))
+		for _, an := range matching {
+			select {
+			case jobs <- analysisJob{path, an}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
 		return nil
 	})
 
-	return files, err
+	close(jobs)
+	wg.Wait()
+	if walkErr != nil {
+		return nil, walkErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.EnvVars = sortedKeys(buckets["env"])
+	a.NodeImports = sortedKeys(buckets["node"])
+	a.PythonImports = sortedKeys(buckets["python"])
+	a.GoImports = sortedKeys(buckets["go"])
+	a.GoTestImports = sortedKeys(buckets["go-test"])
+	return a, nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
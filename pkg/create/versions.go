@@ -0,0 +1,239 @@
+package create
+
+import (
+	"devsnap/pkg/metadata"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// pinReader extracts a version from one pin file. Returns "" if the file doesn't pin the runtime.
+type pinReader struct {
+	file string
+	read func(content string, runtime string) string
+}
+
+// pinFiles lists, per runtime, the files teams commit to pin a toolchain version.
+// Order matters: the first file that pins a version wins.
+var pinFiles = map[string][]pinReader{
+	"node": {
+		{".nvmrc", readPlainVersion},
+		{".node-version", readPlainVersion},
+		{".tool-versions", readToolVersions},
+		{"mise.toml", readMiseToml},
+		{".mise.toml", readMiseToml},
+	},
+	"python": {
+		{".python-version", readPlainVersion},
+		{"runtime.txt", readRuntimeTxt},
+		{".tool-versions", readToolVersions},
+		{"mise.toml", readMiseToml},
+		{".mise.toml", readMiseToml},
+	},
+	"go": {
+		{"go.mod", readGoToolchain},
+		{".go-version", readPlainVersion},
+		{".tool-versions", readToolVersions},
+		{"mise.toml", readMiseToml},
+		{".mise.toml", readMiseToml},
+	},
+	"rust": {
+		{"rust-toolchain.toml", readRustToolchainToml},
+		{"rust-toolchain", readRustToolchain},
+		{".tool-versions", readToolVersions},
+		{"mise.toml", readMiseToml},
+		{".mise.toml", readMiseToml},
+	},
+	"java": {
+		{".java-version", readPlainVersion},
+		{"pom.xml", readPomRelease},
+		{".tool-versions", readToolVersions},
+		{"mise.toml", readMiseToml},
+		{".mise.toml", readMiseToml},
+	},
+	"ruby": {
+		{".ruby-version", readPlainVersion},
+		{".tool-versions", readToolVersions},
+		{"mise.toml", readMiseToml},
+		{".mise.toml", readMiseToml},
+	},
+	"php": {
+		{".tool-versions", readToolVersions},
+		{"mise.toml", readMiseToml},
+		{".mise.toml", readMiseToml},
+	},
+}
+
+// toolAliases are the names asdf/mise use for a runtime
+var toolAliases = map[string][]string{
+	"node":   {"nodejs", "node"},
+	"python": {"python"},
+	"go":     {"golang", "go"},
+	"rust":   {"rust"},
+	"java":   {"java"},
+	"ruby":   {"ruby"},
+	"php":    {"php"},
+}
+
+// runtimeOf maps an environment type to the toolchain it needs
+func runtimeOf(envType string) string {
+	switch {
+	case strings.HasPrefix(envType, "node"), envType == "angular":
+		return "node"
+	case envType == "go", envType == "python", envType == "rust", envType == "java", envType == "ruby", envType == "php":
+		return envType
+	}
+	return ""
+}
+
+// applyPinnedVersion overrides the guessed version with a pinned one, if the project has a pin file.
+// Pin files are looked up from the environment directory up to the project root; the closest wins.
+func applyPinnedVersion(root string, env *metadata.EnvironmentConfig) {
+	runtime := runtimeOf(env.Type)
+	if runtime == "" {
+		return
+	}
+
+	dir := filepath.Join(root, filepath.FromSlash(env.Dir))
+	for {
+		for _, pin := range pinFiles[runtime] {
+			content, err := ioutil.ReadFile(filepath.Join(dir, pin.file))
+			if err != nil {
+				continue
+			}
+			if v := pin.read(string(content), runtime); v != "" {
+				rel, err := filepath.Rel(root, filepath.Join(dir, pin.file))
+				if err != nil {
+					rel = pin.file
+				}
+				env.Version = v
+				env.VersionSource = filepath.ToSlash(rel)
+				return
+			}
+		}
+
+		if filepath.Clean(dir) == filepath.Clean(root) {
+			return
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return
+		}
+		dir = parent
+	}
+}
+
+// readPlainVersion reads files that hold just a version, e.g. .nvmrc ("v20.11.0") or .python-version
+func readPlainVersion(content, _ string) string {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return strings.TrimPrefix(line, "v")
+	}
+	return ""
+}
+
+// readRuntimeTxt reads Heroku-style runtime.txt ("python-3.11.4")
+func readRuntimeTxt(content, _ string) string {
+	v := readPlainVersion(content, "")
+	if strings.HasPrefix(v, "python-") {
+		return strings.TrimPrefix(v, "python-")
+	}
+	return ""
+}
+
+// readToolVersions reads asdf .tool-versions ("nodejs 20.11.0")
+func readToolVersions(content, runtime string) string {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		for _, alias := range toolAliases[runtime] {
+			if fields[0] == alias {
+				return fields[1]
+			}
+		}
+	}
+	return ""
+}
+
+// readMiseToml reads the [tools] table of mise.toml (node = "20" or node = ["20", "18"])
+func readMiseToml(content, runtime string) string {
+	section := tomlSection(content, "tools")
+	for _, alias := range toolAliases[runtime] {
+		re := regexp.MustCompile(`(?m)^\s*"?` + regexp.QuoteMeta(alias) + `"?\s*=\s*(.+)$`)
+		if m := re.FindStringSubmatch(section); m != nil {
+			if values := quotedStrings(m[1]); len(values) > 0 {
+				return values[0]
+			}
+		}
+	}
+	return ""
+}
+
+// readGoToolchain reads the go.mod "toolchain go1.22.3" directive
+func readGoToolchain(content, _ string) string {
+	m := regexp.MustCompile(`(?m)^toolchain\s+go([0-9][^\s]*)`).FindStringSubmatch(content)
+	if m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// readRustToolchainToml reads [toolchain] channel = "1.75.0"
+func readRustToolchainToml(content, _ string) string {
+	m := regexp.MustCompile(`(?m)^\s*channel\s*=\s*"([^"]+)"`).FindStringSubmatch(tomlSection(content, "toolchain"))
+	if m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// readRustToolchain reads the legacy rust-toolchain file, which is either a bare channel or TOML
+func readRustToolchain(content, runtime string) string {
+	if strings.Contains(content, "[toolchain]") {
+		return readRustToolchainToml(content, runtime)
+	}
+	return readPlainVersion(content, runtime)
+}
+
+// readPomRelease reads <maven.compiler.release> (or Spring Boot's <java.version>) from pom.xml.
+// A ${property} reference is resolved from the pom's own properties, else skipped.
+func readPomRelease(content, _ string) string {
+	for _, tag := range []string{"maven.compiler.release", "java.version"} {
+		value := pomProperty(content, tag)
+		for i := 0; i < 3 && strings.HasPrefix(value, "${") && strings.HasSuffix(value, "}"); i++ {
+			value = pomProperty(content, value[2:len(value)-1])
+		}
+		if value != "" && !strings.Contains(value, "${") {
+			return value
+		}
+	}
+	return ""
+}
+
+// pomProperty returns the text of the first <name> element in a pom
+func pomProperty(content, name string) string {
+	re := regexp.MustCompile(`<` + regexp.QuoteMeta(name) + `>\s*([^<\s]+)\s*</`)
+	if m := re.FindStringSubmatch(content); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// tomlSection returns the body of a [name] table (up to the next table header)
+func tomlSection(content, name string) string {
+	header := regexp.MustCompile(`(?m)^\s*\[` + regexp.QuoteMeta(name) + `\]\s*$`).FindStringIndex(content)
+	if header == nil {
+		return ""
+	}
+	body := content[header[1]:]
+	if next := regexp.MustCompile(`(?m)^\s*\[`).FindStringIndex(body); next != nil {
+		body = body[:next[0]]
+	}
+	return body
+}
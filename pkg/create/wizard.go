@@ -0,0 +1,186 @@
+package create
+
+import (
+	"bufio"
+	"devsnap/pkg/metadata"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ReviewResult holds the answers collected by the interactive review wizard
+type ReviewResult struct {
+	Environments []metadata.EnvironmentConfig
+	RequiredVars []string
+	Exclude      []string
+	Save         bool // Persist answers to the project config
+}
+
+// stdin is shared by all wizard prompts so buffered input isn't lost between questions
+var stdin = bufio.NewReader(os.Stdin)
+
+// Review walks the user through the detected configuration before packing.
+// Every entry can be accepted, edited or removed, and new entries can be added.
+func Review(root string, envs []metadata.EnvironmentConfig, reqVars []string, exclude []string, files []string) ReviewResult {
+	fmt.Println("\n🧙 Interactive Review")
+	fmt.Println("---------------------")
+	fmt.Println("Press Enter to keep the value shown in [brackets].")
+
+	// 1. Environments
+	fmt.Printf("\n🌍 Detected %d environment(s):\n", len(envs))
+	for i, e := range envs {
+		printEnvironment(i+1, e)
+	}
+
+	var reviewed []metadata.EnvironmentConfig
+	for _, e := range envs {
+		if !confirm(fmt.Sprintf("Keep environment '%s'?", e.Type), true) {
+			fmt.Printf("   🗑️  Removed %s\n", e.Type)
+			continue
+		}
+		if confirm("Edit it?", false) {
+			e = editEnvironment(e)
+		}
+		reviewed = append(reviewed, e)
+	}
+	for confirm("Add another environment?", false) {
+		reviewed = append(reviewed, editEnvironment(metadata.EnvironmentConfig{}))
+	}
+
+	// 2. Required variables
+	fmt.Printf("\n🔐 Required variables: %s\n", listOrNone(reqVars))
+	reqVars = splitList(ask("Required variables (comma separated, '-' for none)", strings.Join(reqVars, ", ")), ",")
+
+	// 3. Files
+	fmt.Println("\n📁 Files:")
+	printFileSummary(root, files)
+	exclude = splitList(ask("Exclude patterns (comma separated, '-' for none)", strings.Join(exclude, ", ")), ",")
+
+	save := confirm("Save these answers to the project config for next time?", true)
+
+	return ReviewResult{
+		Environments: reviewed,
+		RequiredVars: reqVars,
+		Exclude:      exclude,
+		Save:         save,
+	}
+}
+
+func printEnvironment(index int, e metadata.EnvironmentConfig) {
+	fmt.Printf("  %d. %s", index, e.Type)
+	if e.Version != "" {
+		fmt.Printf(" (%s)", e.Version)
+	}
+	if e.Dir != "" {
+		fmt.Printf(" in %s", e.Dir)
+	}
+	if e.Framework != "" {
+		fmt.Printf(" [%s]", e.Framework)
+	}
+	fmt.Println()
+	if len(e.Setup) > 0 {
+		fmt.Printf("     Setup: %s\n", strings.Join(e.Setup, "; "))
+	}
+	if e.Run != "" {
+		fmt.Printf("     Run:   %s\n", e.Run)
+	}
+	if e.Test != "" {
+		fmt.Printf("     Test:  %s\n", e.Test)
+	}
+}
+
+func editEnvironment(e metadata.EnvironmentConfig) metadata.EnvironmentConfig {
+	e.Type = ask("   Type", e.Type)
+	e.Version = ask("   Version", e.Version)
+	e.Dir = ask("   Directory ('-' for project root)", e.Dir)
+	if e.Dir == "-" || e.Dir == "." {
+		e.Dir = ""
+	}
+	e.Setup = splitList(ask("   Setup commands (separate with ';', '-' for none)", strings.Join(e.Setup, "; ")), ";")
+	e.Run = ask("   Run command ('-' for none)", e.Run)
+	if e.Run == "-" {
+		e.Run = ""
+	}
+	e.Test = ask("   Test command ('-' for none)", e.Test)
+	if e.Test == "-" {
+		e.Test = ""
+	}
+	return e
+}
+
+// printFileSummary prints the file count and a per-directory breakdown
+func printFileSummary(root string, files []string) {
+	counts := make(map[string]int)
+	for _, f := range files {
+		rel, err := filepath.Rel(root, f)
+		if err != nil {
+			rel = f
+		}
+		parts := strings.SplitN(filepath.ToSlash(rel), "/", 2)
+		top := "."
+		if len(parts) == 2 {
+			top = parts[0] + "/"
+		}
+		counts[top]++
+	}
+
+	var dirs []string
+	for d := range counts {
+		dirs = append(dirs, d)
+	}
+	sort.Strings(dirs)
+
+	fmt.Printf("   %d files in total\n", len(files))
+	for _, d := range dirs {
+		fmt.Printf("   %-30s %d\n", d, counts[d])
+	}
+}
+
+// ask prints the question with its default value and returns the answer (or the default)
+func ask(question, def string) string {
+	fmt.Printf("[?] %s [%s]: ", question, def)
+	line, _ := stdin.ReadString('\n')
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return def
+	}
+	return line
+}
+
+// confirm asks a yes/no question; Enter picks the default
+func confirm(question string, def bool) bool {
+	hint := "Y/n"
+	if !def {
+		hint = "y/N"
+	}
+	fmt.Printf("[?] %s (%s): ", question, hint)
+	line, _ := stdin.ReadString('\n')
+	line = strings.ToLower(strings.TrimSpace(line))
+	if line == "" {
+		return def
+	}
+	return line == "y" || line == "yes"
+}
+
+// splitList splits a separated answer into trimmed, non-empty entries. A lone "-" clears the list.
+func splitList(answer, sep string) []string {
+	if strings.TrimSpace(answer) == "-" {
+		return nil
+	}
+	var out []string
+	for _, part := range strings.Split(answer, sep) {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func listOrNone(items []string) string {
+	if len(items) == 0 {
+		return "(none)"
+	}
+	return strings.Join(items, ", ")
+}
@@ -0,0 +1,267 @@
+package devpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// SchemaVersion is the devpack format written by this version of devsnap.
+// Files without a "schema" field are v0 and are migrated when read.
+const SchemaVersion = 1
+
+// Ecosystems a devpack can describe
+const (
+	Node   = "node"
+	Python = "python"
+	Go     = "go"
+)
+
+// Dependency sources
+const (
+	// SourceRegistry installs Name@Version from the package registry (default)
+	SourceRegistry = "registry"
+	// SourceGit installs from a git repository (URL at Ref)
+	SourceGit = "git"
+	// SourceLocal installs from a path inside the snapshot
+	SourceLocal = "local"
+)
+
+// Dependency scopes
+const (
+	// ScopeRuntime is needed to run the app (default)
+	ScopeRuntime = "runtime"
+	// ScopeDev is only needed to build or test it
+	ScopeDev = "dev"
+)
+
+// Devpack pins the dependencies of one environment that has no manifest of its own
+type Devpack struct {
+	Schema    int    `json:"schema"`
+	Ecosystem string `json:"ecosystem"`
+
+	// Registry is the default registry URL (empty means the ecosystem's public one)
+	Registry string `json:"registry,omitempty"`
+
+	Dependencies []Dependency `json:"dependencies"`
+}
+
+// Dependency is one package of a devpack
+type Dependency struct {
+	Name string `json:"name"`
+
+	// Version is exact when a lockfile or install pinned it, else "latest"
+	Version string `json:"version,omitempty"`
+
+	// Source is where the package comes from; empty means SourceRegistry
+	Source string `json:"source,omitempty"`
+
+	// Registry overrides Devpack.Registry for this package
+	Registry string `json:"registry,omitempty"`
+
+	// URL and Ref locate a SourceGit package (Ref is a branch, tag or commit)
+	URL string `json:"url,omitempty"`
+	Ref string `json:"ref,omitempty"`
+
+	// Path locates a SourceLocal package, slash-separated and relative to the snapshot root
+	Path string `json:"path,omitempty"`
+
+	// Scope is ScopeRuntime (default) or ScopeDev
+	Scope string `json:"scope,omitempty"`
+
+	// Integrity is the hash the package manager verifies, e.g. "sha512-..." or "h1:..."
+	Integrity string `json:"integrity,omitempty"`
+}
+
+// New returns an empty devpack for an ecosystem
+func New(ecosystem string) *Devpack {
+	return &Devpack{Schema: SchemaVersion, Ecosystem: ecosystem}
+}
+
+// Ecosystem maps an environment type to the devpack ecosystem that installs it
+// ("node (TypeScript)" and "angular" are node). Returns "" if there is none.
+func Ecosystem(envType string) string {
+	switch {
+	case envType == Node, strings.HasPrefix(envType, "node "), envType == "angular":
+		return Node
+	case envType == Python:
+		return Python
+	case envType == Go:
+		return Go
+	}
+	return ""
+}
+
+// Add appends a dependency, replacing an earlier one with the same name
+func (d *Devpack) Add(dep Dependency) {
+	for i := range d.Dependencies {
+		if d.Dependencies[i].Name == dep.Name {
+			d.Dependencies[i] = dep
+			return
+		}
+	}
+	d.Dependencies = append(d.Dependencies, dep)
+}
+
+// Unpinned returns the registry dependencies without an exact version
+func (d *Devpack) Unpinned() []string {
+	var names []string
+	for _, dep := range d.Dependencies {
+		if dep.SourceKind() == SourceRegistry && (dep.Version == "" || dep.Version == "latest") {
+			names = append(names, dep.Name)
+		}
+	}
+	return names
+}
+
+// SourceKind returns Source, defaulting to SourceRegistry
+func (dep Dependency) SourceKind() string {
+	if dep.Source == "" {
+		return SourceRegistry
+	}
+	return dep.Source
+}
+
+// IsDev reports whether the dependency is only needed for development
+func (dep Dependency) IsDev() bool {
+	return dep.Scope == ScopeDev
+}
+
+// Validate checks the devpack is well-formed
+func (d *Devpack) Validate() error {
+	if d.Schema < 1 || d.Schema > SchemaVersion {
+		return fmt.Errorf("unsupported devpack schema %d (this devsnap reads up to %d)", d.Schema, SchemaVersion)
+	}
+	switch d.Ecosystem {
+	case Node, Python, Go:
+	default:
+		return fmt.Errorf("unknown ecosystem %q", d.Ecosystem)
+	}
+	if err := validateRegistry(d.Registry); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for i, dep := range d.Dependencies {
+		if dep.Name == "" {
+			return fmt.Errorf("dependency #%d has no name", i+1)
+		}
+		if seen[dep.Name] {
+			return fmt.Errorf("dependency %q is listed twice", dep.Name)
+		}
+		seen[dep.Name] = true
+
+		switch dep.SourceKind() {
+		case SourceRegistry:
+			if dep.Version == "" {
+				return fmt.Errorf("dependency %q has no version (use \"latest\")", dep.Name)
+			}
+		case SourceGit:
+			if dep.URL == "" {
+				return fmt.Errorf("git dependency %q has no url", dep.Name)
+			}
+		case SourceLocal:
+			if dep.Path == "" {
+				return fmt.Errorf("local dependency %q has no path", dep.Name)
+			}
+			if p := path.Clean(dep.Path); path.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") {
+				return fmt.Errorf("local dependency %q must stay inside the snapshot, got %q", dep.Name, dep.Path)
+			}
+		default:
+			return fmt.Errorf("dependency %q has unknown source %q", dep.Name, dep.Source)
+		}
+
+		switch dep.Scope {
+		case "", ScopeRuntime, ScopeDev:
+		default:
+			return fmt.Errorf("dependency %q has unknown scope %q", dep.Name, dep.Scope)
+		}
+		if strings.ContainsAny(dep.Integrity, " \t\n") {
+			return fmt.Errorf("dependency %q has a malformed integrity hash", dep.Name)
+		}
+		if err := validateRegistry(dep.Registry); err != nil {
+			return fmt.Errorf("dependency %q: %w", dep.Name, err)
+		}
+	}
+	return nil
+}
+
+func validateRegistry(registry string) error {
+	if registry == "" {
+		return nil
+	}
+	u, err := url.Parse(registry)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("registry must be an http(s) URL, got %q", registry)
+	}
+	return nil
+}
+
+// Read decodes and validates a devpack, migrating older formats
+func Read(r io.Reader) (*Devpack, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var header struct {
+		Schema int `json:"schema"`
+	}
+	if err := json.Unmarshal(content, &header); err != nil {
+		return nil, fmt.Errorf("failed to parse devpack: %w", err)
+	}
+
+	var d *Devpack
+	if header.Schema == 0 {
+		if d, err = migrateV0(content); err != nil {
+			return nil, err
+		}
+	} else {
+		d = &Devpack{}
+		if err := json.Unmarshal(content, d); err != nil {
+			return nil, fmt.Errorf("failed to parse devpack: %w", err)
+		}
+	}
+
+	if err := d.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid devpack: %w", err)
+	}
+	return d, nil
+}
+
+// ReadFile reads a devpack from disk
+func ReadFile(filename string) (*Devpack, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Read(bytes.NewReader(content))
+}
+
+// Write validates the devpack and encodes it, dependencies sorted by name
+func (d *Devpack) Write(w io.Writer) error {
+	if err := d.Validate(); err != nil {
+		return fmt.Errorf("invalid devpack: %w", err)
+	}
+	sort.Slice(d.Dependencies, func(i, j int) bool { return d.Dependencies[i].Name < d.Dependencies[j].Name })
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+// WriteFile writes the devpack to disk
+func (d *Devpack) WriteFile(filename string) error {
+	var buf bytes.Buffer
+	if err := d.Write(&buf); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, buf.Bytes(), 0644)
+}
@@ -0,0 +1,189 @@
+package devpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ErrManifestExists is returned by Materialize when the manifest is already there
+var ErrManifestExists = errors.New("manifest already exists")
+
+// ManifestName returns the standard manifest of an ecosystem
+func ManifestName(ecosystem string) string {
+	switch ecosystem {
+	case Node:
+		return "package.json"
+	case Python:
+		return "requirements.txt"
+	case Go:
+		return "go.mod"
+	}
+	return ""
+}
+
+// Materialize writes the standard manifest for the devpack into dir.
+// name and goVersion come from the snapshot (goVersion may be empty).
+// Returns the manifest file name and, for go.mod, the go get queries still to run
+// (see GoMod). An existing manifest is only replaced with force.
+func (d *Devpack) Materialize(dir, name, goVersion string, force bool) (string, []string, error) {
+	file := ManifestName(d.Ecosystem)
+	target := filepath.Join(dir, file)
+	if _, err := os.Stat(target); err == nil && !force {
+		return file, nil, ErrManifestExists
+	}
+
+	var content []byte
+	var queries []string
+	var err error
+	switch d.Ecosystem {
+	case Node:
+		content, err = d.PackageJSON(name)
+	case Python:
+		content = d.Requirements()
+	case Go:
+		content, queries = d.GoMod(GoModulePath(name), goVersion)
+	default:
+		return "", nil, fmt.Errorf("no manifest for ecosystem %q", d.Ecosystem)
+	}
+	if err != nil {
+		return file, nil, err
+	}
+	return file, queries, ioutil.WriteFile(target, content, 0644)
+}
+
+// NodeSpec returns the package.json / npm install version spec of a dependency
+func (dep Dependency) NodeSpec() string {
+	switch dep.SourceKind() {
+	case SourceGit:
+		spec := "git+" + strings.TrimPrefix(dep.URL, "git+")
+		if dep.Ref != "" {
+			spec += "#" + dep.Ref
+		}
+		return spec
+	case SourceLocal:
+		return "file:" + dep.Path
+	}
+	return dep.Version
+}
+
+// PipRequirement returns the requirements.txt / pip install line of a dependency
+func (dep Dependency) PipRequirement() string {
+	switch dep.SourceKind() {
+	case SourceGit:
+		req := fmt.Sprintf("%s @ git+%s", dep.Name, strings.TrimPrefix(dep.URL, "git+"))
+		if dep.Ref != "" {
+			req += "@" + dep.Ref
+		}
+		return req
+	case SourceLocal:
+		return "./" + dep.Path
+	}
+	if dep.Version == "latest" {
+		return dep.Name
+	}
+	return dep.Name + "==" + dep.Version
+}
+
+// PackageJSON renders a package.json with the devpack's dependencies
+func (d *Devpack) PackageJSON(name string) ([]byte, error) {
+	deps := make(map[string]string)
+	devDeps := make(map[string]string)
+	for _, dep := range d.Dependencies {
+		if dep.IsDev() {
+			devDeps[dep.Name] = dep.NodeSpec()
+		} else {
+			deps[dep.Name] = dep.NodeSpec()
+		}
+	}
+
+	pkg := struct {
+		Name            string            `json:"name"`
+		Version         string            `json:"version"`
+		Private         bool              `json:"private"`
+		Dependencies    map[string]string `json:"dependencies,omitempty"`
+		DevDependencies map[string]string `json:"devDependencies,omitempty"`
+	}{strings.ReplaceAll(GoModulePath(name), "/", "-"), "0.0.0", true, deps, devDeps}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(pkg); err != nil {
+		return nil, err
+	}
+	if d.Registry != "" {
+		// npm reads the registry from .npmrc, not package.json
+		fmt.Printf("   💡 Add 'registry=%s' to .npmrc\n", d.Registry)
+	}
+	return buf.Bytes(), nil
+}
+
+// Requirements renders a requirements.txt; development dependencies come last
+func (d *Devpack) Requirements() []byte {
+	var b strings.Builder
+	if d.Registry != "" {
+		fmt.Fprintf(&b, "--index-url %s\n", d.Registry)
+	}
+	var dev []string
+	for _, dep := range d.Dependencies {
+		if dep.IsDev() {
+			dev = append(dev, dep.PipRequirement())
+			continue
+		}
+		b.WriteString(dep.PipRequirement() + "\n")
+	}
+	if len(dev) > 0 {
+		b.WriteString("\n# Development\n" + strings.Join(dev, "\n") + "\n")
+	}
+	return []byte(b.String())
+}
+
+// GoMod renders a go.mod. Dependencies without an exact version (latest, git refs)
+// can't be written as requires; they are returned as go get queries ("mod@ref").
+func (d *Devpack) GoMod(module, goVersion string) ([]byte, []string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "module %s\n", module)
+	if v := regexp.MustCompile(`[0-9]+\.[0-9]+(\.[0-9]+)?`).FindString(goVersion); v != "" {
+		fmt.Fprintf(&b, "\ngo %s\n", v)
+	}
+
+	var requires, replaces, queries []string
+	for _, dep := range d.Dependencies {
+		switch {
+		case dep.SourceKind() == SourceLocal:
+			requires = append(requires, fmt.Sprintf("\t%s v0.0.0", dep.Name))
+			replaces = append(replaces, fmt.Sprintf("replace %s => ./%s", dep.Name, dep.Path))
+		case dep.SourceKind() == SourceGit && dep.Ref != "":
+			queries = append(queries, dep.Name+"@"+dep.Ref)
+		case dep.SourceKind() == SourceGit, dep.Version == "latest":
+			queries = append(queries, dep.Name+"@latest")
+		default:
+			requires = append(requires, fmt.Sprintf("\t%s %s", dep.Name, dep.Version))
+		}
+	}
+	if len(requires) > 0 {
+		fmt.Fprintf(&b, "\nrequire (\n%s\n)\n", strings.Join(requires, "\n"))
+	}
+	if len(replaces) > 0 {
+		fmt.Fprintf(&b, "\n%s\n", strings.Join(replaces, "\n"))
+	}
+	return []byte(b.String()), queries
+}
+
+// GoModulePath turns a snapshot name into a valid module (or package) name ("My App" -> "my-app")
+func GoModulePath(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = regexp.MustCompile(`[^a-z0-9._~/-]+`).ReplaceAllString(name, "-")
+	name = strings.Trim(name, "-./")
+	if name == "" {
+		return "devsnap-sandbox"
+	}
+	return name
+}
@@ -0,0 +1,66 @@
+package devpack
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// v0 is the original untyped format: {"type": "...", "dependencies": {name: version}, "integrity": {name: hash}}
+type v0 struct {
+	Type         string            `json:"type"`
+	Dependencies map[string]string `json:"dependencies"`
+	Integrity    map[string]string `json:"integrity"`
+}
+
+// migrateV0 converts a v0 devpack. Version strings that point somewhere else
+// (git+https://..., file:...) become git or local dependencies.
+func migrateV0(content []byte) (*Devpack, error) {
+	var old v0
+	if err := json.Unmarshal(content, &old); err != nil {
+		return nil, fmt.Errorf("failed to parse devpack: %w", err)
+	}
+
+	ecosystem := Ecosystem(old.Type)
+	if ecosystem == "" {
+		return nil, fmt.Errorf("devpack type %q has no installer", old.Type)
+	}
+
+	d := New(ecosystem)
+	for name, version := range old.Dependencies {
+		dep := ParseSpec(name, version)
+		dep.Integrity = old.Integrity[name]
+		d.Add(dep)
+	}
+	return d, nil
+}
+
+// ParseSpec turns a package manager version spec into a dependency:
+// "1.2.3", "git+https://host/repo.git#v1", "github:user/repo#main" or "file:../lib"
+func ParseSpec(name, spec string) Dependency {
+	dep := Dependency{Name: name}
+	switch {
+	case strings.HasPrefix(spec, "file:"):
+		dep.Source = SourceLocal
+		dep.Path = strings.TrimPrefix(strings.TrimPrefix(spec, "file:"), "./")
+
+	case strings.HasPrefix(spec, "git+"), strings.HasPrefix(spec, "git://"), strings.HasPrefix(spec, "github:"):
+		dep.Source = SourceGit
+		ref := ""
+		if i := strings.LastIndex(spec, "#"); i != -1 {
+			spec, ref = spec[:i], spec[i+1:]
+		}
+		if strings.HasPrefix(spec, "github:") {
+			spec = "https://github.com/" + strings.TrimPrefix(spec, "github:") + ".git"
+		}
+		dep.URL = strings.TrimPrefix(spec, "git+")
+		dep.Ref = ref
+
+	default:
+		dep.Version = spec
+		if dep.Version == "" {
+			dep.Version = "latest"
+		}
+	}
+	return dep
+}
@@ -0,0 +1,132 @@
+package devpack
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseSpec(t *testing.T) {
+	tests := []struct {
+		spec string
+		want Dependency
+	}{
+		{"1.2.3", Dependency{Name: "pkg", Version: "1.2.3"}},
+		{"^4.18.0", Dependency{Name: "pkg", Version: "^4.18.0"}},
+		{"", Dependency{Name: "pkg", Version: "latest"}},
+		{"git+https://github.com/user/repo.git#v1.0.0", Dependency{Name: "pkg", Source: SourceGit, URL: "https://github.com/user/repo.git", Ref: "v1.0.0"}},
+		{"git+ssh://git@github.com/user/repo.git", Dependency{Name: "pkg", Source: SourceGit, URL: "ssh://git@github.com/user/repo.git"}},
+		{"git://github.com/user/repo.git#main", Dependency{Name: "pkg", Source: SourceGit, URL: "git://github.com/user/repo.git", Ref: "main"}},
+		{"github:user/repo#main", Dependency{Name: "pkg", Source: SourceGit, URL: "https://github.com/user/repo.git", Ref: "main"}},
+		{"file:../lib", Dependency{Name: "pkg", Source: SourceLocal, Path: "../lib"}},
+		{"file:./libs/util", Dependency{Name: "pkg", Source: SourceLocal, Path: "libs/util"}},
+	}
+	for _, tt := range tests {
+		if got := ParseSpec("pkg", tt.spec); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSpec(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestReadMigratesV0(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *Devpack // Dependencies sorted by name
+		wantErr string
+	}{
+		{
+			name:    "registry versions and integrity",
+			content: `{"type": "node", "dependencies": {"express": "4.18.2", "lodash": "latest"}, "integrity": {"express": "sha512-abc"}}`,
+			want: &Devpack{Schema: SchemaVersion, Ecosystem: Node, Dependencies: []Dependency{
+				{Name: "express", Version: "4.18.2", Integrity: "sha512-abc"},
+				{Name: "lodash", Version: "latest"},
+			}},
+		},
+		{
+			name:    "typescript environments are node",
+			content: `{"type": "node (TypeScript)", "dependencies": {"zod": "3.22.4"}}`,
+			want: &Devpack{Schema: SchemaVersion, Ecosystem: Node, Dependencies: []Dependency{
+				{Name: "zod", Version: "3.22.4"},
+			}},
+		},
+		{
+			name:    "git and local sources",
+			content: `{"type": "node", "dependencies": {"lib": "file:./packages/lib", "tool": "github:user/tool#v2"}}`,
+			want: &Devpack{Schema: SchemaVersion, Ecosystem: Node, Dependencies: []Dependency{
+				{Name: "lib", Source: SourceLocal, Path: "packages/lib"},
+				{Name: "tool", Source: SourceGit, URL: "https://github.com/user/tool.git", Ref: "v2"},
+			}},
+		},
+		{
+			name:    "python",
+			content: `{"type": "python", "dependencies": {"requests": "2.31.0"}}`,
+			want: &Devpack{Schema: SchemaVersion, Ecosystem: Python, Dependencies: []Dependency{
+				{Name: "requests", Version: "2.31.0"},
+			}},
+		},
+		{
+			name:    "no dependencies",
+			content: `{"type": "go"}`,
+			want:    &Devpack{Schema: SchemaVersion, Ecosystem: Go},
+		},
+		{
+			name:    "unknown type",
+			content: `{"type": "ruby", "dependencies": {"rails": "7.1.0"}}`,
+			wantErr: `devpack type "ruby" has no installer`,
+		},
+		{
+			name:    "local path outside the snapshot",
+			content: `{"type": "node", "dependencies": {"lib": "file:../lib"}}`,
+			wantErr: "must stay inside the snapshot",
+		},
+		{
+			name:    "not json",
+			content: `dependencies: {}`,
+			wantErr: "failed to parse devpack",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read(strings.NewReader(tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Read() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			// v0 dependencies are a JSON object, so their order isn't kept
+			sort.Slice(got.Dependencies, func(i, j int) bool { return got.Dependencies[i].Name < got.Dependencies[j].Name })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Read() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSchemaVersions(t *testing.T) {
+	tests := []struct {
+		content string
+		wantErr string
+	}{
+		{`{"schema": 1, "ecosystem": "go", "dependencies": [{"name": "github.com/google/uuid", "version": "v1.6.0"}]}`, ""},
+		{`{"schema": 2, "ecosystem": "go", "dependencies": []}`, "unsupported devpack schema 2"},
+		{`{"schema": 1, "ecosystem": "node", "dependencies": [{"name": "a", "version": "1.0.0"}, {"name": "a", "version": "2.0.0"}]}`, `dependency "a" is listed twice`},
+		{`{"schema": 1, "ecosystem": "node", "dependencies": [{"name": "a"}]}`, `dependency "a" has no version`},
+		{`{"schema": 1, "ecosystem": "node", "registry": "ftp://example.com", "dependencies": []}`, "registry must be an http(s) URL"},
+	}
+	for _, tt := range tests {
+		_, err := Read(strings.NewReader(tt.content))
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("Read(%s) error = %v", tt.content, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("Read(%s) error = %v, want it to contain %q", tt.content, err, tt.wantErr)
+		}
+	}
+}
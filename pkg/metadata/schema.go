@@ -1,5 +1,9 @@
 package metadata
 
+// GeneratedDir is the archive prefix reserved for files devsnap generates (devpacks).
+// Project files under it are never archived.
+const GeneratedDir = ".devsnap"
+
 // SnapshotMetadata represents the "brain" of the snapshot.
 // It describes the environment, commands, and identity of the snapshot.
 type SnapshotMetadata struct {
@@ -13,6 +17,12 @@ type SnapshotMetadata struct {
 	Tags        []string `json:"tags,omitempty"`
 	CreatedAt   string   `json:"created_at"` // ISO 8601
 
+	// Parent is the snapshot this one was re-created from (create --from-sandbox)
+	Parent *ParentSnapshot `json:"parent,omitempty"`
+
+	// Git is the commit the project was checked out at, used as the merge base by restore
+	Git *GitProvenance `json:"git,omitempty"`
+
 	// Environment Requirements
 	Environments []EnvironmentConfig `json:"environments"`
 
@@ -20,7 +30,8 @@ type SnapshotMetadata struct {
 	Commands LifecycleCommands `json:"commands"`
 
 	// Secrets / Config
-	RequiredVars []string `json:"required_vars,omitempty"`
+	RequiredVars []string             `json:"required_vars,omitempty"`
+	Variables    []VariableDefinition `json:"variables,omitempty"`
 
 	// Files to include (optional explicit list, or pattern)
 	// If empty, defaults to all files in archive
@@ -31,15 +42,98 @@ type EnvironmentConfig struct {
 	// Base platform hint, e.g., "node", "python", "go", "docker"
 	Type string `json:"type"`
 
+	// Name other environments use in depends_on. Defaults to Dir, then Type.
+	Name string `json:"name,omitempty"`
+
 	// Version constraints, e.g. ">=18.0.0"
 	Version string `json:"version,omitempty"`
 
+	// File the version was read from, e.g. ".nvmrc" (empty if it is a default guess)
+	VersionSource string `json:"version_source,omitempty"`
+
+	// Package manager, optionally pinned (e.g. "pnpm@8.6.0", "poetry", "uv")
+	PackageManager string `json:"package_manager,omitempty"`
+
 	// Optional: Image to use if Type == "docker"
 	Image string `json:"image,omitempty"`
 
+	// Working directory relative to the snapshot root (monorepos), e.g. "frontend".
+	// Empty means the root.
+	Dir string `json:"dir,omitempty"`
+
+	// Web framework the run command starts, e.g. "Next.js", "FastAPI" (empty if none was recognised)
+	Framework string `json:"framework,omitempty"`
+
+	// Port the dev server listens on and the address it binds to (empty means the framework's default)
+	Port int    `json:"port,omitempty"`
+	Host string `json:"host,omitempty"`
+
+	// Variable the app reads its port from when start has to move it (default "PORT")
+	PortVar string `json:"port_var,omitempty"`
+
+	// The port is a literal in the source code, so start can't move it when it is taken
+	PortFixed bool `json:"port_fixed,omitempty"`
+
 	// Per-environment commands
 	Setup []string `json:"setup,omitempty"`
 	Run   string   `json:"run,omitempty"`
+	Test  string   `json:"test,omitempty"`
+
+	// Devpack dependencies no lockfile could pin; they install at their latest version
+	Unpinned []string `json:"unpinned,omitempty"`
+
+	// Environments whose service must be ready before this one runs
+	DependsOn []string `json:"depends_on,omitempty"`
+
+	// Ready tells when the service is up (default: its port accepts connections)
+	Ready *ReadinessProbe `json:"ready,omitempty"`
+}
+
+// ReadinessProbe decides when a service is ready for the environments that depend on it.
+// Set one check; if several are set, all of them must pass.
+type ReadinessProbe struct {
+	// TCP is a port that must accept connections
+	TCP int `json:"tcp,omitempty"`
+
+	// HTTP is a path on the service port that must answer 2xx, e.g. "/health"
+	HTTP string `json:"http,omitempty"`
+
+	// Log is a regular expression a line of the service output must match
+	Log string `json:"log,omitempty"`
+
+	// Command must exit 0; it is retried until then
+	Command string `json:"command,omitempty"`
+
+	// Timeout is how long to wait, e.g. "90s" (default 60s)
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// ParentSnapshot identifies the snapshot a sandbox was unpacked from
+type ParentSnapshot struct {
+	Name      string `json:"name"`
+	ID        string `json:"id"` // SHA-256 of the parent .devsnap file
+	CreatedAt string `json:"created_at,omitempty"`
+}
+
+// GitProvenance records where in a git repository a snapshot was taken
+type GitProvenance struct {
+	Commit string `json:"commit"`
+	Branch string `json:"branch,omitempty"`
+	Remote string `json:"remote,omitempty"` // origin URL, without credentials
+	Path   string `json:"path,omitempty"`   // Snapshot root inside the repository, e.g. "services/api/" ("" for the top level)
+	Dirty  bool   `json:"dirty,omitempty"`  // The snapshot has changes that aren't committed
+}
+
+// VariableDefinition documents an environment variable the project reads
+type VariableDefinition struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+
+	// Default is written to the sandbox .env and used when the variable is unset
+	Default string `json:"default,omitempty"`
+
+	// Required variables are prompted for at start if they have no value
+	Required bool `json:"required,omitempty"`
 }
 
 type LifecycleCommands struct {
@@ -0,0 +1,306 @@
+package start
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"devsnap/pkg/metadata"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runDir holds the pidfiles, logs and state of detached services, inside the sandbox
+var runDir = filepath.Join(metadata.GeneratedDir, "run")
+
+// RunState describes the detached services of one sandbox
+type RunState struct {
+	Snapshot string         `json:"snapshot"`
+	Sandbox  string         `json:"sandbox"` // Absolute path
+	Started  time.Time      `json:"started"`
+	Services []ServiceState `json:"services"`
+}
+
+// ServiceState is one detached service
+type ServiceState struct {
+	Name      string `json:"name"` // envName, what logs and stop take
+	Type      string `json:"type"`
+	Framework string `json:"framework,omitempty"`
+	PID       int    `json:"pid"`
+	Port      int    `json:"port,omitempty"`
+	URL       string `json:"url,omitempty"`
+	Log       string `json:"log"` // Relative to the sandbox
+}
+
+// Running reports whether the service process is still alive
+func (s ServiceState) Running() bool {
+	return s.PID > 0 && processAlive(s.PID)
+}
+
+// fileName turns a service name into a file name ("apps/web" -> "apps-web")
+func fileName(name string) string {
+	return strings.NewReplacer("/", "-", `\`, "-", ":", "-").Replace(name)
+}
+
+// openServiceLog creates the log file of a detached service
+func openServiceLog(sandbox, name string) (*os.File, string, error) {
+	rel := filepath.Join(runDir, fileName(name)+".log")
+	if err := os.MkdirAll(filepath.Join(sandbox, runDir), 0755); err != nil {
+		return nil, "", err
+	}
+	f, err := os.OpenFile(filepath.Join(sandbox, rel), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	return f, rel, err
+}
+
+// resetRunState forgets the services of an earlier detached run. start refuses to
+// run a sandbox whose services are alive, so the ones it lists have all exited.
+func resetRunState(sandbox string) error {
+	err := os.Remove(filepath.Join(sandbox, runDir, "services.json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// recordService writes the pidfile of a detached service and adds it to the sandbox state,
+// in place of an earlier service of the same name
+func recordService(sandbox, snapshot string, svc ServiceState) error {
+	pidfile := filepath.Join(sandbox, runDir, fileName(svc.Name)+".pid")
+	if err := ioutil.WriteFile(pidfile, []byte(strconv.Itoa(svc.PID)+"\n"), 0644); err != nil {
+		return err
+	}
+
+	state, err := ReadRunState(sandbox)
+	if err != nil || state == nil {
+		abs, _ := filepath.Abs(sandbox)
+		state = &RunState{Snapshot: snapshot, Sandbox: abs, Started: time.Now()}
+	}
+	replaced := false
+	for i := range state.Services {
+		if state.Services[i].Name == svc.Name {
+			state.Services[i], replaced = svc, true
+			break
+		}
+	}
+	if !replaced {
+		state.Services = append(state.Services, svc)
+	}
+	if err := writeRunState(sandbox, state); err != nil {
+		return err
+	}
+	return register(state.Sandbox)
+}
+
+// ReadRunState reads the detached services of a sandbox (nil if none were started)
+func ReadRunState(sandbox string) (*RunState, error) {
+	content, err := ioutil.ReadFile(filepath.Join(sandbox, runDir, "services.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state RunState
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse run state: %w", err)
+	}
+	return &state, nil
+}
+
+func writeRunState(sandbox string, state *RunState) error {
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(sandbox, runDir, "services.json"), content, 0644)
+}
+
+// HasRunning reports whether a sandbox still has detached services alive
+func HasRunning(sandbox string) bool {
+	state, err := ReadRunState(sandbox)
+	if err != nil || state == nil {
+		return false
+	}
+	for _, s := range state.Services {
+		if s.Running() {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the service called name ("" matches when the sandbox has a single service)
+func (st *RunState) Find(name string) (*ServiceState, error) {
+	if name == "" {
+		if len(st.Services) == 1 {
+			return &st.Services[0], nil
+		}
+		return nil, fmt.Errorf("sandbox runs %d services, name one of: %s", len(st.Services), strings.Join(st.names(), ", "))
+	}
+	for i := range st.Services {
+		if st.Services[i].Name == name {
+			return &st.Services[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no service '%s' (running: %s)", name, strings.Join(st.names(), ", "))
+}
+
+func (st *RunState) names() []string {
+	var names []string
+	for _, s := range st.Services {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// Stop shuts services down gracefully (SIGTERM), killing those still alive after timeout.
+// An empty name stops every service of the sandbox.
+func Stop(sandbox, name string, timeout time.Duration) error {
+	state, err := ReadRunState(sandbox)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return fmt.Errorf("no detached services in %s", sandbox)
+	}
+
+	var targets []*ServiceState
+	if name == "" {
+		for i := range state.Services {
+			targets = append(targets, &state.Services[i])
+		}
+	} else {
+		svc, err := state.Find(name)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, svc)
+	}
+
+	for _, svc := range targets {
+		if !svc.Running() {
+			fmt.Printf("   💤 %s is not running\n", svc.Name)
+			continue
+		}
+		fmt.Printf("   🛑 Stopping %s (pid %d)...\n", svc.Name, svc.PID)
+		if err := terminateProcess(svc.PID); err != nil {
+			fmt.Printf("      ⚠️  %v\n", err)
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+	for _, svc := range targets {
+		for svc.Running() && time.Now().Before(deadline) {
+			time.Sleep(200 * time.Millisecond)
+		}
+		if svc.Running() {
+			fmt.Printf("   💀 %s did not exit after %s, killing it\n", svc.Name, timeout)
+			if err := killProcess(svc.PID); err != nil {
+				return fmt.Errorf("failed to kill %s: %w", svc.Name, err)
+			}
+		}
+		os.Remove(filepath.Join(sandbox, runDir, fileName(svc.Name)+".pid"))
+	}
+
+	if !HasRunning(sandbox) {
+		unregister(state.Sandbox)
+	}
+	return nil
+}
+
+// TailLog prints a service log. With follow it keeps printing new output until the service exits.
+func TailLog(sandbox string, svc ServiceState, follow bool, w io.Writer) error {
+	f, err := os.Open(filepath.Join(sandbox, svc.Log))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		chunk, err := r.ReadBytes('\n')
+		w.Write(chunk)
+		if err == io.EOF {
+			if !follow || !svc.Running() {
+				return nil
+			}
+			time.Sleep(300 * time.Millisecond)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// registryDir lists the sandboxes with detached services, so ps finds them from anywhere.
+// It lives in the XDG state directory (~/.local/state/devsnap/running).
+func registryDir() (string, error) {
+	return xdgDir("XDG_STATE_HOME", ".local/state", "running")
+}
+
+func registryEntry(sandbox string) (string, error) {
+	dir, err := registryDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(sandbox))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])), nil
+}
+
+func register(sandbox string) error {
+	entry, err := registryEntry(sandbox)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(entry), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(entry, []byte(sandbox), 0644)
+}
+
+func unregister(sandbox string) {
+	if entry, err := registryEntry(sandbox); err == nil {
+		os.Remove(entry)
+	}
+}
+
+// RunningSandboxes returns the state of every sandbox with detached services,
+// forgetting sandboxes whose services have all exited or that were deleted.
+func RunningSandboxes() ([]*RunState, error) {
+	dir, err := registryDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var states []*RunState
+	for _, e := range entries {
+		content, err := ioutil.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		sandbox := string(content)
+		state, err := ReadRunState(sandbox)
+		if err != nil || state == nil || !HasRunning(sandbox) {
+			os.Remove(filepath.Join(dir, e.Name()))
+			continue
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Sandbox < states[j].Sandbox })
+	return states, nil
+}
@@ -0,0 +1,321 @@
+package start
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around each hunk, as in git
+const diffContext = 3
+
+// fileVersion is one side of a file diff (nil when the file doesn't exist on that side)
+type fileVersion struct {
+	content []byte
+	mode    os.FileMode
+}
+
+// diffOp is one line of an edit script: ' ' kept, '-' removed, '+' added
+type diffOp struct {
+	kind byte
+	line string // With its line ending, if it had one
+}
+
+// splitLines splits content after each '\n', so a missing final newline is a difference
+func splitLines(content []byte) []string {
+	var lines []string
+	for len(content) > 0 {
+		i := bytes.IndexByte(content, '\n')
+		if i == -1 {
+			lines = append(lines, string(content))
+			break
+		}
+		lines = append(lines, string(content[:i+1]))
+		content = content[i+1:]
+	}
+	return lines
+}
+
+// isBinary uses git's heuristic: a NUL byte in the first 8000 bytes
+func isBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+	return bytes.IndexByte(content, 0) != -1
+}
+
+// diffLines computes a shortest edit script from a to b (Myers' algorithm)
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	// Forward pass: v[k] is the furthest x reached on diagonal k with d edits
+	found := false
+	for d := 0; d <= max && !found; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // Down: insertion
+			} else {
+				x = v[offset+k-1] + 1 // Right: deletion
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	// Backtrack from (n, m) through the saved states
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x, y = x-1, y-1
+		}
+		if x == prevX {
+			ops = append(ops, diffOp{'+', b[y-1]})
+			y--
+		} else {
+			ops = append(ops, diffOp{'-', a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, diffOp{' ', a[x-1]})
+		x, y = x-1, y-1
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// writeHunks writes an edit script as unified diff hunks
+func writeHunks(w io.Writer, ops []diffOp) {
+	// Lines of a and b before each op, for the hunk headers
+	aBefore, bBefore := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, op := range ops {
+		aBefore[i+1], bBefore[i+1] = aBefore[i], bBefore[i]
+		if op.kind != '+' {
+			aBefore[i+1]++
+		}
+		if op.kind != '-' {
+			bBefore[i+1]++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// A hunk runs until diffContext*2 unchanged lines separate two changes
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*diffContext {
+				break
+			}
+		}
+		end += diffContext
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(aBefore[start], aBefore[end]-aBefore[start]), hunkRange(bBefore[start], bBefore[end]-bBefore[start]))
+		for _, op := range ops[start:end] {
+			w.Write([]byte{op.kind})
+			io.WriteString(w, op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				io.WriteString(w, "\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+}
+
+// hunkRange formats "start,count" like git: an empty range starts at the line before it
+func hunkRange(before, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", before)
+	case 1:
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
+
+// gitMode is the mode git records for a file
+func gitMode(mode os.FileMode) string {
+	if mode&0111 != 0 {
+		return "100755"
+	}
+	return "100644"
+}
+
+// writeFileDiff writes the git-style diff of one file. Binary files get git's one-line
+// notice, or are left out (returning false) when the patch must apply.
+func writeFileDiff(w io.Writer, path string, old, new *fileVersion, forApply bool) bool {
+	var oldContent, newContent []byte
+	if old != nil {
+		oldContent = old.content
+	}
+	if new != nil {
+		newContent = new.content
+	}
+	binary := isBinary(oldContent) || isBinary(newContent)
+	if binary && forApply {
+		return false
+	}
+
+	fmt.Fprintf(w, "diff --git a/%s b/%s\n", path, path)
+	switch {
+	case old == nil:
+		fmt.Fprintf(w, "new file mode %s\n", gitMode(new.mode))
+	case new == nil:
+		fmt.Fprintf(w, "deleted file mode %s\n", gitMode(old.mode))
+	case gitMode(old.mode) != gitMode(new.mode):
+		fmt.Fprintf(w, "old mode %s\nnew mode %s\n", gitMode(old.mode), gitMode(new.mode))
+	}
+
+	from, to := "a/"+path, "b/"+path
+	if old == nil {
+		from = "/dev/null"
+	}
+	if new == nil {
+		to = "/dev/null"
+	}
+	if binary {
+		fmt.Fprintf(w, "Binary files %s and %s differ\n", from, to)
+		return true
+	}
+	if bytes.Equal(oldContent, newContent) {
+		return true // Empty file, or a mode change only
+	}
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", from, to)
+	writeHunks(w, diffLines(splitLines(oldContent), splitLines(newContent)))
+	return true
+}
+
+// readArchiveFiles reads the given project files from a snapshot
+func readArchiveFiles(snapshotPath string, paths map[string]bool) (map[string]*fileVersion, error) {
+	file, err := os.Open(snapshotPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer file.Close()
+
+	gr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gr.Close()
+
+	files := make(map[string]*fileVersion)
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tar reading error: %w", err)
+		}
+		name := filepath.ToSlash(filepath.Clean(header.Name))
+		if header.Typeflag != tar.TypeReg || !paths[name] {
+			continue
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = &fileVersion{content, os.FileMode(header.Mode)}
+	}
+}
+
+// WriteSandboxDiff writes the changes of a sandbox as a git-style diff against the snapshot
+// it was unpacked from. With forApply the result is a patch git apply accepts: files it
+// can't express (binary files, files setup wrote that aren't in the snapshot) are left out
+// and returned.
+func WriteSandboxDiff(dir string, changes []Change, w io.Writer, forApply bool) (skipped []string, err error) {
+	info, err := ReadSandboxInfo(dir)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, fmt.Errorf("%s is not a devsnap sandbox", dir)
+	}
+
+	wanted := make(map[string]bool)
+	for _, c := range changes {
+		if c.Kind != "added" {
+			wanted[c.Path] = true
+		}
+	}
+	var pristine map[string]*fileVersion
+	if len(wanted) > 0 {
+		if pristine, err = readArchiveFiles(info.SnapshotPath, wanted); err != nil {
+			return nil, fmt.Errorf("the original files come from %s: %w", info.SnapshotPath, err)
+		}
+	}
+
+	for _, c := range changes {
+		var old, new *fileVersion
+		if c.Kind != "added" {
+			if old = pristine[c.Path]; old == nil {
+				skipped = append(skipped, c.Path) // Written by setup, the snapshot has no original
+				continue
+			}
+		}
+		if c.Kind != "deleted" {
+			path := filepath.Join(dir, filepath.FromSlash(c.Path))
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				return skipped, err
+			}
+			fi, err := os.Stat(path)
+			if err != nil {
+				return skipped, err
+			}
+			new = &fileVersion{content, fi.Mode()}
+		}
+		if !writeFileDiff(w, c.Path, old, new, forApply) {
+			skipped = append(skipped, c.Path)
+		}
+	}
+	return skipped, nil
+}
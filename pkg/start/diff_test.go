@@ -0,0 +1,175 @@
+package start
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// numbered returns the lines "1\n" to "n\n", with the given lines replaced
+func numbered(n int, replace map[int]string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		line, ok := replace[i]
+		if !ok {
+			line = strconv.Itoa(i)
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  string
+		edits int // Length of the shortest edit script
+	}{
+		{"both empty", "", "", 0},
+		{"equal", "a\nb\n", "a\nb\n", 0},
+		{"added to empty", "", "a\nb\n", 2},
+		{"emptied", "a\nb\n", "", 2},
+		{"one line changed", "a\nb\nc\n", "a\nB\nc\n", 2},
+		{"line inserted", "a\nc\n", "a\nb\nc\n", 1},
+		{"line removed", "a\nb\nc\n", "a\nc\n", 1},
+		{"missing final newline", "a\nb", "a\nb\n", 2},
+		{"reversed", "a\nb\nc\n", "c\nb\na\n", 4},
+		{"classic myers example", "a\nb\nc\na\nb\nb\na\n", "c\nb\na\nb\na\nc\n", 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops := diffLines(splitLines([]byte(tt.a)), splitLines([]byte(tt.b)))
+
+			// Kept and removed lines rebuild a, kept and added lines rebuild b
+			var a, b strings.Builder
+			edits := 0
+			for _, op := range ops {
+				switch op.kind {
+				case ' ':
+					a.WriteString(op.line)
+					b.WriteString(op.line)
+				case '-':
+					a.WriteString(op.line)
+					edits++
+				case '+':
+					b.WriteString(op.line)
+					edits++
+				default:
+					t.Fatalf("unknown op %q", op.kind)
+				}
+			}
+			if a.String() != tt.a || b.String() != tt.b {
+				t.Errorf("edit script rebuilds %q -> %q, want %q -> %q", a.String(), b.String(), tt.a, tt.b)
+			}
+			if edits != tt.edits {
+				t.Errorf("edit script has %d edits, want %d", edits, tt.edits)
+			}
+		})
+	}
+}
+
+func TestWriteHunks(t *testing.T) {
+	// Expected output is what git diff --diff-algorithm=myers prints after the file header
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"no changes", "a\nb\n", "a\nb\n", ""},
+		{
+			"one line changed",
+			"a\nb\nc\n", "a\nB\nc\n",
+			"@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			"new file",
+			"", "x\ny\n",
+			"@@ -0,0 +1,2 @@\n+x\n+y\n",
+		},
+		{
+			"deleted file",
+			"x\ny\n", "",
+			"@@ -1,2 +0,0 @@\n-x\n-y\n",
+		},
+		{
+			"single line files",
+			"x\n", "y\n",
+			"@@ -1 +1 @@\n-x\n+y\n",
+		},
+		{
+			"missing final newline",
+			"a\nb", "a\nb\n",
+			"@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			"changes close together share a hunk",
+			numbered(10, nil), numbered(10, map[int]string{3: "three", 9: "nine"}),
+			"@@ -1,10 +1,10 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n 7\n 8\n-9\n+nine\n 10\n",
+		},
+		{
+			"changes far apart get their own hunks",
+			numbered(20, nil), numbered(20, map[int]string{2: "TWO", 19: "NINETEEN"}),
+			"@@ -1,5 +1,5 @@\n 1\n-2\n+TWO\n 3\n 4\n 5\n@@ -16,5 +16,5 @@\n 16\n 17\n 18\n-19\n+NINETEEN\n 20\n",
+		},
+		{
+			"insertion in the middle",
+			numbered(10, nil), strings.Replace(numbered(10, nil), "\n5\n", "\n5\nnew\n", 1),
+			"@@ -3,6 +3,7 @@\n 3\n 4\n 5\n+new\n 6\n 7\n 8\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writeHunks(&buf, diffLines(splitLines([]byte(tt.a)), splitLines([]byte(tt.b))))
+			if got := buf.String(); got != tt.want {
+				t.Errorf("writeHunks() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteFileDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new *fileVersion
+		forApply bool
+		want     string
+		wantOK   bool
+	}{
+		{
+			"added",
+			nil, &fileVersion{[]byte("hi\n"), 0644}, false,
+			"diff --git a/f b/f\nnew file mode 100644\n--- /dev/null\n+++ b/f\n@@ -0,0 +1 @@\n+hi\n", true,
+		},
+		{
+			"deleted",
+			&fileVersion{[]byte("hi\n"), 0755}, nil, false,
+			"diff --git a/f b/f\ndeleted file mode 100755\n--- a/f\n+++ /dev/null\n@@ -1 +0,0 @@\n-hi\n", true,
+		},
+		{
+			"mode change only",
+			&fileVersion{[]byte("hi\n"), 0644}, &fileVersion{[]byte("hi\n"), 0755}, false,
+			"diff --git a/f b/f\nold mode 100644\nnew mode 100755\n", true,
+		},
+		{
+			"binary",
+			&fileVersion{[]byte("a\x00b"), 0644}, &fileVersion{[]byte("a\x00c"), 0644}, false,
+			"diff --git a/f b/f\nBinary files a/f and b/f differ\n", true,
+		},
+		{
+			"binary left out of patches",
+			&fileVersion{[]byte("a\x00b"), 0644}, &fileVersion{[]byte("a\x00c"), 0644}, true,
+			"", false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			ok := writeFileDiff(&buf, "f", tt.old, tt.new, tt.forApply)
+			if ok != tt.wantOK || buf.String() != tt.want {
+				t.Errorf("writeFileDiff() = %t,\n%s\nwant %t,\n%s", ok, buf.String(), tt.wantOK, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package start
+
+import (
+	"devsnap/pkg/metadata"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// defaultPortVar is the variable apps conventionally read their port from
+const defaultPortVar = "PORT"
+
+// portWait bounds how long the summary waits for services to start listening
+const portWait = 30 * time.Second
+
+// portInUse reports whether something on the host already listens on port.
+// An empty host checks every interface, which also catches servers bound to 127.0.0.1.
+func portInUse(host string, port int) bool {
+	l, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return true
+	}
+	l.Close()
+	return false
+}
+
+// freePort finds the first free port after from, skipping ports already handed out
+func freePort(host string, from int, taken map[int]bool) int {
+	for p := from + 1; p < from+100 && p <= 65535; p++ {
+		if !taken[p] && !portInUse(host, p) {
+			return p
+		}
+	}
+	// Crowded range: let the OS pick one
+	l, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return 0
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// assignPort picks the port an environment runs on: its own, or a free one if that is taken
+// (by another program or an earlier environment of this snapshot). Returns 0 if it has no port.
+// A port hard-coded in the source stays, with a warning.
+func assignPort(env metadata.EnvironmentConfig, taken map[int]bool) int {
+	if env.Port == 0 {
+		return 0
+	}
+	port := env.Port
+	if taken[port] || portInUse(env.Host, port) {
+		if env.PortFixed {
+			fmt.Printf("   ⚠️  Port %d is in use, but %s hard-codes it in its source and will likely fail to listen. Free the port, or read it from %s.\n", port, env.Type, portVar(env))
+		} else {
+			port = freePort(env.Host, port, taken)
+		}
+	}
+	taken[port] = true
+	return port
+}
+
+// remapPort rewrites a literal port in the run command ("--port 3000", "-p 3000", "127.0.0.1:3000")
+func remapPort(run string, from, to int) string {
+	re := regexp.MustCompile(`(^|[^0-9])` + strconv.Itoa(from) + `([^0-9]|$)`)
+	return re.ReplaceAllString(run, "${1}"+strconv.Itoa(to)+"${2}")
+}
+
+// portVar returns the variable an environment reads its port from
+func portVar(env metadata.EnvironmentConfig) string {
+	if env.PortVar != "" {
+		return env.PortVar
+	}
+	return defaultPortVar
+}
+
+// serviceURL returns where a service can be reached
+func serviceURL(env metadata.EnvironmentConfig, port int) string {
+	host := env.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// waitForPort polls until something accepts connections on port or the deadline passes
+func waitForPort(env metadata.EnvironmentConfig, port int, deadline time.Time, exited <-chan struct{}) bool {
+	host := env.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	for time.Now().Before(deadline) {
+		if conn, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+			conn.Close()
+			return true
+		}
+		select {
+		case <-exited:
+			return false
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+	return false
+}
+
+// printServices prints the URL of every service that has a port
+func printServices(services []*service) {
+	var withPorts []*service
+	for _, s := range services {
+		if s.port != 0 {
+			withPorts = append(withPorts, s)
+		}
+	}
+	if len(withPorts) == 0 {
+		return
+	}
+
+	deadline := time.Now().Add(portWait)
+	fmt.Println("\n🌐 Services:")
+	for _, s := range withPorts {
+		status := "✅"
+		if !waitForPort(s.env, s.port, deadline, s.exited) {
+			status = "⏳"
+		}
+		name := s.env.Type
+		if s.env.Framework != "" {
+			name += " (" + s.env.Framework + ")"
+		}
+		if s.env.Dir != "" {
+			name += " in " + s.env.Dir
+		}
+		line := fmt.Sprintf("   %s %-28s %s", status, name, serviceURL(s.env, s.port))
+		if s.port != s.env.Port {
+			line += fmt.Sprintf("  (remapped from %d)", s.env.Port)
+		}
+		fmt.Println(line)
+	}
+}
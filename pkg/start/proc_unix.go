@@ -0,0 +1,27 @@
+//go:build !windows
+
+package start
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachProcess starts the command in its own session, so it outlives devsnap and the terminal
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// terminateProcess asks the service and its children (its process group) to shut down
+func terminateProcess(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGTERM)
+}
+
+func killProcess(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGKILL)
+}
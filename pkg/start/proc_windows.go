@@ -0,0 +1,36 @@
+//go:build windows
+
+package start
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// detachedProcess is DETACHED_PROCESS: no console shared with devsnap
+const detachedProcess = 0x00000008
+
+// detachProcess starts the command outside devsnap's console, so it outlives it
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | detachedProcess}
+}
+
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
+
+// terminateProcess asks the service and its child processes to close
+func terminateProcess(pid int) error {
+	return exec.Command("taskkill", "/PID", strconv.Itoa(pid), "/T").Run()
+}
+
+func killProcess(pid int) error {
+	return exec.Command("taskkill", "/PID", strconv.Itoa(pid), "/T", "/F").Run()
+}
@@ -0,0 +1,288 @@
+package start
+
+import (
+	"bytes"
+	"context"
+	"devsnap/pkg/metadata"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultReadyTimeout bounds the wait for a service that others depend on
+const defaultReadyTimeout = 60 * time.Second
+
+// envName is how depends_on refers to an environment: its name, else its directory, else its type
+func envName(env metadata.EnvironmentConfig) string {
+	switch {
+	case env.Name != "":
+		return env.Name
+	case env.Dir != "":
+		return env.Dir
+	}
+	return env.Type
+}
+
+// orderEnvironments sorts environments so each comes after the ones it depends on,
+// keeping the detection order otherwise. It also checks the readiness probes parse.
+func orderEnvironments(envs []metadata.EnvironmentConfig) ([]metadata.EnvironmentConfig, error) {
+	index := make(map[string]int)
+	ambiguous := make(map[string]bool)
+	for i, env := range envs {
+		name := envName(env)
+		if _, ok := index[name]; ok {
+			ambiguous[name] = true
+		}
+		index[name] = i
+		if _, _, err := parseProbe(env.Ready, env.Port); err != nil {
+			return nil, fmt.Errorf("environment '%s': %w", name, err)
+		}
+	}
+
+	// Depth-first, visiting dependencies before the environment itself
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(envs))
+	var ordered []metadata.EnvironmentConfig
+	var visit func(i int, path []string) error
+	visit = func(i int, path []string) error {
+		name := envName(envs[i])
+		switch state[i] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s -> %s", strings.Join(path, " -> "), name)
+		}
+		state[i] = visiting
+		for _, dep := range envs[i].DependsOn {
+			j, ok := index[dep]
+			if !ok {
+				return fmt.Errorf("environment '%s' depends on unknown environment '%s'", name, dep)
+			}
+			if ambiguous[dep] {
+				return fmt.Errorf("environment '%s' depends on '%s', which names several environments (give them a name)", name, dep)
+			}
+			if err := visit(j, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[i] = done
+		ordered = append(ordered, envs[i])
+		return nil
+	}
+	for i := range envs {
+		if err := visit(i, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// parseProbe validates the probe of an environment listening on port (0 for none)
+// and returns its timeout and compiled log pattern
+func parseProbe(p *metadata.ReadinessProbe, port int) (time.Duration, *regexp.Regexp, error) {
+	if p == nil {
+		return defaultReadyTimeout, nil, nil
+	}
+	if p.TCP < 0 || p.TCP > 65535 {
+		return 0, nil, fmt.Errorf("invalid readiness port %d", p.TCP)
+	}
+	// The http probe has no port of its own, it checks the service's
+	if p.HTTP != "" && port == 0 {
+		return 0, nil, fmt.Errorf("readiness probe http %q needs the environment's \"port\"", p.HTTP)
+	}
+	timeout := defaultReadyTimeout
+	if p.Timeout != "" {
+		d, err := time.ParseDuration(p.Timeout)
+		if err != nil || d <= 0 {
+			return 0, nil, fmt.Errorf("invalid readiness timeout %q", p.Timeout)
+		}
+		timeout = d
+	}
+	var re *regexp.Regexp
+	if p.Log != "" {
+		var err error
+		if re, err = regexp.Compile(p.Log); err != nil {
+			return 0, nil, fmt.Errorf("invalid readiness log pattern: %w", err)
+		}
+	}
+	return timeout, re, nil
+}
+
+// awaitReady runs the service's probe and closes s.ready when it settles (s.readyErr says how)
+func (s *service) awaitReady(dir string, xenv *execEnv) {
+	defer close(s.ready)
+	timeout, _, _ := parseProbe(s.env.Ready, s.env.Port)
+	deadline := time.Now().Add(timeout)
+
+	p := s.env.Ready
+	if p == nil {
+		if s.port == 0 {
+			return // Nothing to wait for: started is ready
+		}
+		p = &metadata.ReadinessProbe{TCP: s.env.Port}
+	}
+
+	host := s.env.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	port := func(declared int) int {
+		// A probe on the declared port follows the service when it was moved
+		if declared == s.env.Port && s.port != 0 {
+			return s.port
+		}
+		return declared
+	}
+
+	var checks []readinessCheck
+	if p.TCP != 0 {
+		addr := net.JoinHostPort(host, strconv.Itoa(port(p.TCP)))
+		checks = append(checks, readinessCheck{"port " + strconv.Itoa(port(p.TCP)), func() bool {
+			conn, err := net.DialTimeout("tcp", addr, time.Second)
+			if err == nil {
+				conn.Close()
+			}
+			return err == nil
+		}})
+	}
+	if p.HTTP != "" {
+		url := "http://" + net.JoinHostPort(host, strconv.Itoa(port(s.env.Port))) + "/" + strings.TrimPrefix(p.HTTP, "/")
+		client := &http.Client{Timeout: 2 * time.Second}
+		checks = append(checks, readinessCheck{url, func() bool {
+			resp, err := client.Get(url)
+			if err != nil {
+				return false
+			}
+			resp.Body.Close()
+			return resp.StatusCode >= 200 && resp.StatusCode < 300
+		}})
+	}
+	if p.Log != "" {
+		checks = append(checks, readinessCheck{"log /" + p.Log + "/", s.logs.matched})
+	}
+	if p.Command != "" {
+		checks = append(checks, readinessCheck{"'" + p.Command + "'", func() bool { return probeCommand(dir, p.Command, xenv, deadline) }})
+	}
+
+	for _, c := range checks {
+		for !c.ok() {
+			select {
+			case <-s.exited:
+				s.readyErr = fmt.Errorf("exited before it was ready")
+				return
+			case <-time.After(500 * time.Millisecond):
+			}
+			if time.Now().After(deadline) {
+				s.readyErr = fmt.Errorf("not ready after %s (waiting for %s)", timeout, c.what)
+				return
+			}
+		}
+	}
+}
+
+// readinessCheck is one condition of a probe, polled until it holds
+type readinessCheck struct {
+	what string
+	ok   func() bool
+}
+
+// probeCommand runs a readiness command once and reports whether it exited 0
+func probeCommand(dir, cmdStr string, xenv *execEnv, deadline time.Time) bool {
+	parts := strings.Fields(cmdStr)
+	if len(parts) == 0 {
+		return true
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, xenv.lookPath(parts[0]), parts[1:]...)
+	cmd.Env = xenv.environ()
+	cmd.Dir = dir
+	return cmd.Run() == nil
+}
+
+// awaitDependencies blocks until the services env depends on are ready.
+// Returns false if one of them failed, so env should not run.
+func awaitDependencies(env metadata.EnvironmentConfig, started map[string]*service) bool {
+	for _, dep := range env.DependsOn {
+		s := started[dep]
+		if s == nil {
+			fmt.Printf("   ⚠️  '%s' is not running, starting %s without it\n", dep, envName(env))
+			continue
+		}
+		fmt.Printf("   ⏳ Waiting for '%s' to be ready...\n", dep)
+		<-s.ready
+		if s.readyErr != nil {
+			fmt.Printf("   ❌ '%s' %v\n", dep, s.readyErr)
+			return false
+		}
+		fmt.Printf("   ✅ '%s' is ready\n", dep)
+	}
+	return true
+}
+
+// logWatcher passes output through and remembers whether a line matched a pattern.
+// Detached services write to a file instead, which matched reads.
+type logWatcher struct {
+	mu      sync.Mutex
+	re      *regexp.Regexp
+	file    string
+	partial []byte
+	seen    bool
+}
+
+func (w *logWatcher) Write(p []byte) (int, error) {
+	if w == nil {
+		return len(p), nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.seen {
+		return len(p), nil
+	}
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i == -1 {
+			break
+		}
+		if w.re.Match(w.partial[:i]) {
+			w.seen, w.partial = true, nil
+			return len(p), nil
+		}
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// matched reports whether a complete line matched (or the unterminated last one does)
+func (w *logWatcher) matched() bool {
+	if w == nil {
+		return true
+	}
+	if w.file != "" {
+		content, err := ioutil.ReadFile(w.file)
+		if err != nil {
+			return false
+		}
+		for _, line := range bytes.Split(content, []byte("\n")) {
+			if w.re.Match(line) {
+				return true
+			}
+		}
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.seen || w.re.Match(w.partial)
+}
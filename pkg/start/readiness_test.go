@@ -0,0 +1,63 @@
+package start
+
+import (
+	"devsnap/pkg/metadata"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProbe(t *testing.T) {
+	tests := []struct {
+		name        string
+		probe       *metadata.ReadinessProbe
+		port        int
+		wantTimeout time.Duration
+		wantLog     bool
+		wantErr     string
+	}{
+		{name: "no probe", probe: nil, wantTimeout: defaultReadyTimeout},
+		{name: "tcp without an env port", probe: &metadata.ReadinessProbe{TCP: 5432}, wantTimeout: defaultReadyTimeout},
+		{name: "http on the env port", probe: &metadata.ReadinessProbe{HTTP: "/health"}, port: 8000, wantTimeout: defaultReadyTimeout},
+		{name: "custom timeout", probe: &metadata.ReadinessProbe{TCP: 6379, Timeout: "90s"}, wantTimeout: 90 * time.Second},
+		{name: "log pattern", probe: &metadata.ReadinessProbe{Log: `Listening on port \d+`}, wantTimeout: defaultReadyTimeout, wantLog: true},
+		{name: "command", probe: &metadata.ReadinessProbe{Command: "pg_isready"}, wantTimeout: defaultReadyTimeout},
+		{name: "http without a port", probe: &metadata.ReadinessProbe{HTTP: "/health"}, wantErr: `needs the environment's "port"`},
+		{name: "tcp port out of range", probe: &metadata.ReadinessProbe{TCP: 70000}, wantErr: "invalid readiness port 70000"},
+		{name: "negative tcp port", probe: &metadata.ReadinessProbe{TCP: -1}, wantErr: "invalid readiness port -1"},
+		{name: "unparsable timeout", probe: &metadata.ReadinessProbe{TCP: 80, Timeout: "soon"}, wantErr: `invalid readiness timeout "soon"`},
+		{name: "zero timeout", probe: &metadata.ReadinessProbe{TCP: 80, Timeout: "0s"}, wantErr: `invalid readiness timeout "0s"`},
+		{name: "bad log pattern", probe: &metadata.ReadinessProbe{Log: "ready("}, wantErr: "invalid readiness log pattern"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeout, re, err := parseProbe(tt.probe, tt.port)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseProbe() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseProbe() error = %v", err)
+			}
+			if timeout != tt.wantTimeout {
+				t.Errorf("timeout = %s, want %s", timeout, tt.wantTimeout)
+			}
+			if (re != nil) != tt.wantLog {
+				t.Errorf("log pattern = %v, want one: %t", re, tt.wantLog)
+			}
+		})
+	}
+}
+
+func TestOrderEnvironmentsRejectsBadProbes(t *testing.T) {
+	envs := []metadata.EnvironmentConfig{
+		{Type: "postgres"},
+		{Type: "python", Dir: "worker", DependsOn: []string{"postgres"}, Ready: &metadata.ReadinessProbe{HTTP: "/health"}},
+	}
+	_, err := orderEnvironments(envs)
+	if err == nil || !strings.HasPrefix(err.Error(), "environment 'worker': ") {
+		t.Fatalf("orderEnvironments() error = %v, want one naming environment 'worker'", err)
+	}
+}
@@ -0,0 +1,343 @@
+package start
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"devsnap/pkg/config"
+	"devsnap/pkg/metadata"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrRestoreConflicts is returned by Restore when files changed on both sides and nothing says how to resolve them
+var ErrRestoreConflicts = errors.New("conflicting local changes")
+
+// RestoreOptions controls how Restore treats files changed both locally and in the snapshot
+type RestoreOptions struct {
+	DryRun    bool // Only print what would happen
+	Overwrite bool // Conflicts take the snapshot's version
+	Merge     bool // Conflicts are merged three-way against the snapshot's git commit
+}
+
+// Restore actions, decided per file by planRestore
+const (
+	restoreAdd       = "add"       // Missing locally
+	restoreUpdate    = "update"    // Changed in the snapshot only
+	restoreUnchanged = "unchanged" // Same on both sides
+	restoreKeep      = "keep"      // Changed locally only
+	restoreConflict  = "conflict"  // Changed on both sides (or no merge base to tell)
+	restoreIgnored   = "ignored"   // Ignored in the target, never touched
+	restoreGenerated = "generated" // Devpacks, written to the target's .devsnap
+)
+
+// restoreFile is one file of the snapshot and what restoring it does
+type restoreFile struct {
+	path    string // Slash-separated, relative to the snapshot root
+	content []byte
+	mode    os.FileMode
+	action  string
+	base    []byte // Content at the snapshot's git commit (nil if unknown)
+	merged  []byte // Three-way merge result
+	clashes bool   // The merge left conflict markers
+	why     string // Why a conflict can't be merged
+}
+
+// Restore applies a snapshot onto an existing checkout. Files only the snapshot changed
+// are written, files only changed locally are kept, and files changed on both sides are
+// conflicts: Restore writes nothing unless opts resolve them all. Nothing is deleted, and
+// paths the target ignores (node_modules, .env, .gitignore'd files) are never touched.
+func Restore(snapshotPath, target string, opts RestoreOptions) error {
+	meta, files, err := readRestoreArchive(snapshotPath)
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Stat(target); err != nil || !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", target)
+	}
+
+	git := meta.Git
+	if git != nil && !gitHasCommit(target, git.Commit) {
+		fmt.Printf("⚠️  Commit %.12s isn't in %s (not a checkout of the repo, or try git fetch), comparing without a merge base\n", git.Commit, target)
+		git = nil
+	}
+	if err := planRestore(target, files, git); err != nil {
+		return err
+	}
+
+	// Resolve conflicts before writing anything, so a refusal leaves the tree as it was
+	unresolved := 0
+	for _, f := range files {
+		if f.action != restoreConflict {
+			continue
+		}
+		switch {
+		case opts.Overwrite:
+		case opts.Merge && f.why == "":
+			if f.merged, f.clashes, err = mergeFile(target, f); err != nil {
+				f.why = err.Error()
+				unresolved++
+			}
+		default:
+			unresolved++
+		}
+	}
+
+	printRestorePlan(files, opts)
+	if unresolved > 0 {
+		switch {
+		case opts.Merge:
+			fmt.Printf("\n❌ %d conflict(s) can't be merged. Use --overwrite to take the snapshot's version.\n", unresolved)
+		case git != nil:
+			fmt.Printf("\n❌ %d file(s) changed both locally and in the snapshot. Use --merge or --overwrite.\n", unresolved)
+		default:
+			fmt.Printf("\n❌ %d file(s) differ and there is no merge base to tell who changed them. Use --overwrite.\n", unresolved)
+		}
+		return ErrRestoreConflicts
+	}
+	if opts.DryRun {
+		fmt.Println("\n🧪 Dry run, nothing was written.")
+		return nil
+	}
+
+	written := 0
+	for _, f := range files {
+		var content []byte
+		switch f.action {
+		case restoreAdd, restoreUpdate, restoreGenerated:
+			content = f.content
+		case restoreConflict:
+			content = f.content
+			if opts.Merge {
+				content = f.merged
+			}
+		default:
+			continue
+		}
+		dest := filepath.Join(target, filepath.FromSlash(f.path))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(dest, content, f.mode); err != nil {
+			return err
+		}
+		written++
+	}
+	fmt.Printf("\n✅ Restored %d file(s) into %s\n", written, target)
+	return nil
+}
+
+// readRestoreArchive reads a snapshot's metadata and files into memory
+func readRestoreArchive(snapshotPath string) (metadata.SnapshotMetadata, []*restoreFile, error) {
+	meta, err := ReadMetadata(snapshotPath)
+	if err != nil {
+		return meta, nil, err
+	}
+
+	file, err := os.Open(snapshotPath)
+	if err != nil {
+		return meta, nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer file.Close()
+	gr, err := gzip.NewReader(file)
+	if err != nil {
+		return meta, nil, fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gr.Close()
+
+	var files []*restoreFile
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return meta, nil, fmt.Errorf("tar reading error: %w", err)
+		}
+		name := path.Clean(filepath.ToSlash(header.Name))
+		if header.Typeflag != tar.TypeReg || name == "metadata.json" || path.IsAbs(name) || strings.HasPrefix(name, "..") {
+			continue
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return meta, nil, err
+		}
+		files = append(files, &restoreFile{path: name, content: content, mode: os.FileMode(header.Mode).Perm()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return meta, files, nil
+}
+
+// planRestore decides what happens to each file. With git provenance, the file at the
+// snapshot's commit tells a local change from a snapshot change.
+func planRestore(target string, files []*restoreFile, git *metadata.GitProvenance) error {
+	cfg, err := config.Load(target)
+	if err != nil {
+		return fmt.Errorf("loading project config: %w", err)
+	}
+	gitIgnored := gitIgnoredPaths(target, files)
+
+	for _, f := range files {
+		if strings.HasPrefix(f.path, metadata.GeneratedDir+"/") {
+			f.action = restoreGenerated
+			continue
+		}
+		if ignoredPath(f.path) || cfg.Excludes(f.path) || gitIgnored[f.path] {
+			f.action = restoreIgnored
+			continue
+		}
+
+		local, err := ioutil.ReadFile(filepath.Join(target, filepath.FromSlash(f.path)))
+		switch {
+		case os.IsNotExist(err):
+			f.action = restoreAdd
+			continue
+		case err != nil:
+			return err
+		case bytes.Equal(local, f.content):
+			f.action = restoreUnchanged
+			continue
+		}
+
+		f.action = restoreConflict
+		if git == nil {
+			f.why = "no merge base"
+			continue
+		}
+		base, ok := gitShow(target, git.Commit, git.Path+f.path)
+		switch {
+		case !ok:
+			f.why = "not in the snapshot's commit"
+		case bytes.Equal(base, local):
+			f.action = restoreUpdate
+		case bytes.Equal(base, f.content):
+			f.action = restoreKeep
+		case isBinary(base) || isBinary(local) || isBinary(f.content):
+			f.why = "binary"
+		default:
+			f.base = base
+		}
+	}
+	return nil
+}
+
+// printRestorePlan lists every file restore touches or refuses to
+func printRestorePlan(files []*restoreFile, opts RestoreOptions) {
+	counts := make(map[string]int)
+	for _, f := range files {
+		counts[f.action]++
+		switch f.action {
+		case restoreAdd:
+			fmt.Printf("   ➕ %s\n", f.path)
+		case restoreUpdate:
+			fmt.Printf("   📝 %s\n", f.path)
+		case restoreKeep:
+			fmt.Printf("   ✋ %s (changed locally only, kept)\n", f.path)
+		case restoreConflict:
+			switch {
+			case opts.Overwrite:
+				fmt.Printf("   ⚠️  %s (conflict, overwritten with the snapshot's version)\n", f.path)
+			case opts.Merge && f.why == "" && f.clashes:
+				fmt.Printf("   ⚔️  %s (merged with conflict markers, resolve them)\n", f.path)
+			case opts.Merge && f.why == "":
+				fmt.Printf("   🔀 %s (merged)\n", f.path)
+			case f.why != "":
+				fmt.Printf("   ⚔️  %s (conflict: differs locally, %s)\n", f.path, f.why)
+			default:
+				fmt.Printf("   ⚔️  %s (conflict: changed locally and in the snapshot)\n", f.path)
+			}
+		}
+	}
+	if n := counts[restoreUnchanged]; n > 0 {
+		fmt.Printf("   ♻️  %d file(s) already up to date\n", n)
+	}
+	if n := counts[restoreIgnored]; n > 0 {
+		fmt.Printf("   🙈 %d ignored file(s) left alone\n", n)
+	}
+	if n := counts[restoreGenerated]; n > 0 {
+		fmt.Printf("   📦 %d devpack(s) to %s/ (see 'devsnap materialize')\n", n, metadata.GeneratedDir)
+	}
+}
+
+// mergeFile merges the snapshot's changes into the local file (git merge-file).
+// clashes reports conflict markers in the result.
+func mergeFile(target string, f *restoreFile) (merged []byte, clashes bool, err error) {
+	tmp, err := ioutil.TempDir("", "devsnap-merge-")
+	if err != nil {
+		return nil, false, err
+	}
+	defer os.RemoveAll(tmp)
+
+	local, err := ioutil.ReadFile(filepath.Join(target, filepath.FromSlash(f.path)))
+	if err != nil {
+		return nil, false, err
+	}
+	// git merge-file names the sides after -L, in the order of the files
+	args := []string{"merge-file", "-p", "-L", "local", "-L", "base", "-L", "snapshot"}
+	for _, side := range []struct {
+		name    string
+		content []byte
+	}{{"local", local}, {"base", f.base}, {"snapshot", f.content}} {
+		p := filepath.Join(tmp, side.name)
+		if err := ioutil.WriteFile(p, side.content, 0644); err != nil {
+			return nil, false, err
+		}
+		args = append(args, p)
+	}
+
+	var out bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = &out
+	err = cmd.Run()
+	// Exit status is the number of conflicts; negative (255+) is a failure
+	if exit, ok := err.(*exec.ExitError); ok && exit.ExitCode() > 0 && exit.ExitCode() < 128 {
+		return out.Bytes(), true, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("git merge-file failed: %w", err)
+	}
+	return out.Bytes(), false, nil
+}
+
+// gitHasCommit reports whether the repository at dir has the commit
+func gitHasCommit(dir, commit string) bool {
+	cmd := exec.Command("git", "cat-file", "-e", commit+"^{commit}")
+	cmd.Dir = dir
+	return cmd.Run() == nil
+}
+
+// gitShow reads a file (path from the repository root) at a commit
+func gitShow(dir, commit, file string) ([]byte, bool) {
+	cmd := exec.Command("git", "show", commit+":"+file)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	return out, err == nil
+}
+
+// gitIgnoredPaths returns the files the target's .gitignore rules ignore (none if it isn't a git checkout)
+func gitIgnoredPaths(dir string, files []*restoreFile) map[string]bool {
+	ignored := make(map[string]bool)
+	var paths bytes.Buffer
+	for _, f := range files {
+		paths.WriteString(f.path + "\n")
+	}
+	cmd := exec.Command("git", "check-ignore", "--stdin")
+	cmd.Dir = dir
+	cmd.Stdin = &paths
+	out, _ := cmd.Output() // Exits 1 when nothing is ignored
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			ignored[filepath.ToSlash(line)] = true
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,145 @@
+package start
+
+import (
+	"devsnap/pkg/metadata"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTree writes files (slash-separated paths) under dir
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// snapshotFiles builds the files of a snapshot as readRestoreArchive returns them
+func snapshotFiles(files map[string]string) []*restoreFile {
+	var list []*restoreFile
+	for name, content := range files {
+		list = append(list, &restoreFile{path: name, content: []byte(content), mode: 0644})
+	}
+	return list
+}
+
+type plannedFile struct {
+	action  string
+	why     string
+	hasBase bool
+}
+
+func checkPlan(t *testing.T, files []*restoreFile, want map[string]plannedFile) {
+	t.Helper()
+	for _, f := range files {
+		w, ok := want[f.path]
+		if !ok {
+			t.Errorf("%s: unexpected file in the plan", f.path)
+			continue
+		}
+		if got := (plannedFile{f.action, f.why, f.base != nil}); got != w {
+			t.Errorf("%s: planned %+v, want %+v", f.path, got, w)
+		}
+	}
+}
+
+func TestPlanRestoreWithoutGit(t *testing.T) {
+	target := t.TempDir()
+	writeTree(t, target, map[string]string{
+		"devsnap.json": `{"exclude": ["secrets"]}`,
+		"same.txt":     "same\n",
+		"changed.txt":  "local\n",
+	})
+
+	files := snapshotFiles(map[string]string{
+		"devsnap.json":            `{"exclude": ["secrets"]}`,
+		"same.txt":                "same\n",
+		"changed.txt":             "snapshot\n",
+		"docs/new.md":             "# new\n",
+		".devsnap/go.devpack":     "{}",
+		"node_modules/x/index.js": "module.exports = 1\n",
+		"secrets/key.pem":         "KEY\n",
+	})
+	if err := planRestore(target, files, nil); err != nil {
+		t.Fatalf("planRestore() error = %v", err)
+	}
+	checkPlan(t, files, map[string]plannedFile{
+		"devsnap.json":            {action: restoreUnchanged},
+		"same.txt":                {action: restoreUnchanged},
+		"changed.txt":             {action: restoreConflict, why: "no merge base"},
+		"docs/new.md":             {action: restoreAdd},
+		".devsnap/go.devpack":     {action: restoreGenerated},
+		"node_modules/x/index.js": {action: restoreIgnored},
+		"secrets/key.pem":         {action: restoreIgnored},
+	})
+}
+
+func TestPlanRestoreWithGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	target := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false"}, args...)...)
+		cmd.Dir = target
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	// The snapshot was taken from this commit
+	writeTree(t, target, map[string]string{
+		".gitignore":     "*.log\n",
+		"snapshot.txt":   "base\n",
+		"local.txt":      "base\n",
+		"both.txt":       "one\ntwo\nthree\n",
+		"binary.bin":     "base\x00",
+		"uncommitted.go": "",
+	})
+	git("init", "-q")
+	git("add", ".gitignore", "snapshot.txt", "local.txt", "both.txt", "binary.bin")
+	git("commit", "-q", "-m", "base")
+	commit := git("rev-parse", "HEAD")
+
+	// Then the checkout moved on
+	writeTree(t, target, map[string]string{
+		"local.txt":      "local\n",
+		"both.txt":       "one\ntwo (local)\nthree\n",
+		"binary.bin":     "local\x00",
+		"uncommitted.go": "package local\n",
+		"debug.log":      "local\n",
+	})
+
+	files := snapshotFiles(map[string]string{
+		"snapshot.txt":   "snapshot\n",
+		"local.txt":      "base\n",
+		"both.txt":       "one\ntwo\nthree (snapshot)\n",
+		"binary.bin":     "snapshot\x00",
+		"uncommitted.go": "package snapshot\n",
+		"debug.log":      "snapshot\n",
+	})
+	if err := planRestore(target, files, &metadata.GitProvenance{Commit: commit}); err != nil {
+		t.Fatalf("planRestore() error = %v", err)
+	}
+	checkPlan(t, files, map[string]plannedFile{
+		"snapshot.txt":   {action: restoreUpdate},
+		"local.txt":      {action: restoreKeep},
+		"both.txt":       {action: restoreConflict, hasBase: true},
+		"binary.bin":     {action: restoreConflict, why: "binary"},
+		"uncommitted.go": {action: restoreConflict, why: "not in the snapshot's commit"},
+		"debug.log":      {action: restoreIgnored},
+	})
+}
@@ -1,32 +1,52 @@
 package start
 
 import (
+	"devsnap/pkg/devpack"
 	"devsnap/pkg/metadata"
-	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 )
 
+// Options controls how a snapshot is run
+type Options struct {
+	// Manual prompts before every step
+	Manual bool
+
+	// SnapshotID identifies the snapshot (see SnapshotID), used to reuse virtualenvs across restarts
+	SnapshotID string
+
+	// Detach leaves the services running in the background, logging to the sandbox (see Stop)
+	Detach bool
+}
+
 // Run executes the lifecycle commands in the given directory
-func Run(dir string, meta metadata.SnapshotMetadata, manualMode bool) error {
+func Run(dir string, meta metadata.SnapshotMetadata, opts Options) error {
+	manualMode := opts.Manual
+
 	fmt.Printf("🚀 Starting sandbox for '%s'...\n", meta.Name)
 	if manualMode {
 		fmt.Println("🎮 Manual Control Mode Active: You will be prompted before each step.")
 	}
 
 	// 0. Env Guard (Check Secrets)
-	ensureEnvTemplate(dir, meta.RequiredVars)
+	ensureEnvTemplate(dir, meta.RequiredVars, meta.Variables)
 	loadEnvFile(dir)
+	applyVariableDefaults(meta.Variables)
 	// Validate secrets
 	if len(meta.RequiredVars) > 0 {
 		fmt.Printf("🔐 Checking %d required environment variables...\n", len(meta.RequiredVars))
 		for _, v := range meta.RequiredVars {
 			if os.Getenv(v) == "" {
 				fmt.Printf("   ⚠️  Missing Secret: '%s'\n", v)
+				if def := findVariable(meta.Variables, v); def != nil && def.Description != "" {
+					fmt.Printf("      (%s)\n", def.Description)
+				}
 				fmt.Printf("      Enter value for %s: ", v)
 				var val string
 				fmt.Scanln(&val)
@@ -40,23 +60,79 @@ func Run(dir string, meta metadata.SnapshotMetadata, manualMode bool) error {
 		}
 	}
 
-	// 1. Iterate Environments
+	// Services run side by side. Only a lone service gets the terminal's input,
+	// otherwise it would swallow the answers to the next prompts.
+	var services []*service
+	started := make(map[string]*service) // By envName, for depends_on
+	takenPorts := make(map[int]bool)
+	runnable := 0
 	for _, env := range meta.Environments {
+		if env.Run != "" {
+			runnable++
+		}
+	}
+
+	// Setup steps completed by earlier starts. Manual answers can decline
+	// part of a step, so only automatic runs are recorded.
+	cache := loadSetupCache(dir)
+
+	// Dependencies first; a cycle or a bad probe stops before anything runs
+	envs, err := orderEnvironments(meta.Environments)
+	if err != nil {
+		return err
+	}
+	if opts.Detach {
+		if err := resetRunState(dir); err != nil {
+			return fmt.Errorf("failed to reset run state: %w", err)
+		}
+	}
+
+	// 1. Iterate Environments
+	for _, env := range envs {
 		fmt.Printf("\n🌍 Setting up environment: %s (%s)\n", env.Type, env.Version)
 
+		// Monorepo environments run inside their own subdirectory
+		workDir, err := envDir(dir, env)
+		if err != nil {
+			fmt.Printf("   ❌ %v. Skipping setup & run.\n", err)
+			continue
+		}
+		if env.Dir != "" {
+			fmt.Printf("   📁 Directory: %s\n", env.Dir)
+		}
+
 		// A. Pre-flight Check (Runtime Availability)
-		if !checkRuntime(env.Type) {
-			fmt.Printf("   ❌ Compiler/Runtime not found: '%s'. Skipping setup & run.\n", env.Type)
+		if tool, ok := checkRuntime(env); !ok {
+			fmt.Printf("   ❌ Compiler/Runtime not found: '%s'. Skipping setup & run.\n", tool)
+			if env.PackageManager != "" && tool != "node" && tool != "bun" {
+				fmt.Println("      💡 Try 'corepack enable' to get the package manager this project pins.")
+			}
 			continue
 		}
 
-		// B. Setup
+		// Python never installs into the host interpreter (Zero Pollution)
+		var xenv *execEnv
+		if env.Type == "python" {
+			if xenv, err = pythonExecEnv(workDir, env, opts.SnapshotID); err != nil {
+				fmt.Printf("   ❌ %v. Skipping setup & run.\n", err)
+				continue
+			}
+		}
+
+		// B. Setup (steps that already ran with the same inputs are skipped)
 		if len(env.Setup) > 0 {
 			if manualMode && !promptUser(fmt.Sprintf("Install dependencies for %s?", env.Type)) {
 				fmt.Println("   ⏭️  Skipping setup...")
 			} else {
 				fmt.Println("   📦 Installing dependencies...")
 				for _, cmdStr := range env.Setup {
+					key := stepKey(env, cmdStr)
+					if cache.done(key, cache.stepHash(workDir, env, cmdStr)) {
+						fmt.Printf("   ♻️  Up to date: %s\n", cmdStr)
+						continue
+					}
+					untouched := cache.untouched(workDir)
+
 					// Check for devpack marker with filename support
 					// Format: #DEVPACK:filename or legacy #DEVPACK_INSTALL
 					if strings.HasPrefix(cmdStr, "#DEVPACK") {
@@ -65,72 +141,234 @@ func Run(dir string, meta metadata.SnapshotMetadata, manualMode bool) error {
 							filename = strings.TrimPrefix(cmdStr, "#DEVPACK:")
 						}
 
-						if err := installFromDevpack(dir, filename, manualMode); err != nil {
+						if err := installFromDevpack(dir, filename, meta.Name, env, manualMode, xenv); err != nil {
 							fmt.Printf("      ⚠️  Devpack install failed: %v\n", err)
+						} else if !manualMode {
+							cache.record(key, cache.stepHash(workDir, env, cmdStr), untouched)
 						}
 						continue
 					}
 
-					if err := execute(dir, cmdStr); err != nil {
+					if err := executeWith(workDir, cmdStr, xenv); err != nil {
 						fmt.Printf("      ⚠️  Setup command failed: %v\n", err)
+					} else if !manualMode {
+						// Hashed after the step: installs often write the lockfile themselves
+						cache.record(key, cache.stepHash(workDir, env, cmdStr), untouched)
 					}
 				}
 			}
 		}
 
-		// C. Run
+		// poetry and pipenv create their virtualenv during setup
+		if env.Type == "python" {
+			markVenv(workDir, opts.SnapshotID)
+		}
+
+		// C. Run (in the background, so the next environment can start too)
 		if env.Run != "" {
-			// In standard mode, we *ask* before running to avoid blocking the shell forever on the first service
-			// But user wants "One-Click".
-			// Compromise: In manual mode we ask. In auto mode, we warn "Starting X..."
-			// BUT: If we have multiple run commands (Node + Python), the first one creates a blocking process?
-			// devsnap is designed for single-process snapshots usually.
-			// For Polyglot, maybe we should run them in background?
-			// For now, let's keep it sequential / blocking.
-
-			if promptUser(fmt.Sprintf("Run start command for %s?\n    CMD: %s", env.Type, env.Run)) {
-				fmt.Printf("▶️  Running: %s\n", env.Run)
-				if err := execute(dir, env.Run); err != nil {
+			if !awaitDependencies(env, started) {
+				fmt.Println("   ⏭️  Skipping run command.")
+			} else if promptUser(fmt.Sprintf("Run start command for %s?\n    CMD: %s", env.Type, env.Run)) {
+				run := env.Run
+				var vars []string
+				port := assignPort(env, takenPorts)
+				if port != 0 {
+					if port != env.Port {
+						fmt.Printf("   🔀 Port %d is in use, moving %s to %d (%s=%d)\n", env.Port, env.Type, port, portVar(env), port)
+						run = remapPort(run, env.Port, port)
+					}
+					vars = append(vars, fmt.Sprintf("%s=%d", portVar(env), port))
+				}
+
+				fmt.Printf("▶️  Running: %s\n", run)
+				_, logPattern, _ := parseProbe(env.Ready, env.Port)
+				sopts := serviceOptions{stdin: runnable == 1 && !opts.Detach, logPattern: logPattern}
+				var logFile string
+				if opts.Detach {
+					f, rel, err := openServiceLog(dir, envName(env))
+					if err != nil {
+						return fmt.Errorf("failed to create log: %w", err)
+					}
+					defer f.Close()
+					sopts.log, logFile = f, rel
+				}
+				s, err := startService(workDir, run, xenv.with(vars...), sopts)
+				if err != nil {
 					return fmt.Errorf("run failed: %w", err)
 				}
+				s.env, s.port = env, port
+				if opts.Detach {
+					svc := ServiceState{Name: envName(env), Type: env.Type, Framework: env.Framework, PID: s.cmd.Process.Pid, Port: port, Log: logFile}
+					if port != 0 {
+						svc.URL = serviceURL(env, port)
+					}
+					if err := recordService(dir, meta.Name, svc); err != nil {
+						fmt.Printf("   ⚠️  Failed to record %s: %v\n", svc.Name, err)
+					}
+				}
+				go s.awaitReady(workDir, xenv.with(vars...))
+				services = append(services, s)
+				started[envName(env)] = s
 			} else {
 				fmt.Println("   ⏭️  Skipping run command.")
 			}
 		}
 	}
 
-	return nil
+	printServices(services)
+	if opts.Detach {
+		if len(services) > 0 {
+			fmt.Println("\n🔌 Detached. See 'devsnap ps', 'devsnap logs <service>' and 'devsnap stop'.")
+		}
+		return nil
+	}
+	return waitServices(services)
+}
+
+// service is a running run command
+type service struct {
+	env    metadata.EnvironmentConfig
+	port   int // Port it was started on (0 if it has none)
+	cmd    *exec.Cmd
+	exited chan struct{}
+	err    error
+
+	ready    chan struct{} // Closed when the readiness probe settles
+	readyErr error         // Why it never became ready
+	logs     *logWatcher   // Output watched by a log probe (nil without one)
 }
 
-func checkRuntime(envType string) bool {
+// serviceOptions controls where a service's input and output go
+type serviceOptions struct {
+	stdin      bool           // Attach the terminal's input
+	log        *os.File       // Detached: write output here instead of the terminal, in a session of its own
+	logPattern *regexp.Regexp // Watch the output for a readiness log probe
+}
+
+// startService starts a run command without waiting for it
+func startService(dir, cmdStr string, xenv *execEnv, opts serviceOptions) (*service, error) {
+	s := &service{exited: make(chan struct{}), ready: make(chan struct{})}
+	parts := strings.Fields(cmdStr)
+	cmd := exec.Command(xenv.lookPath(parts[0]), parts[1:]...)
+	cmd.Env = xenv.environ()
+	cmd.Dir = dir
+
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	switch {
+	case opts.log != nil:
+		// Straight to the file: a pipe would break when devsnap exits
+		cmd.Stdout, cmd.Stderr = opts.log, opts.log
+		detachProcess(cmd)
+		if opts.logPattern != nil {
+			s.logs = &logWatcher{re: opts.logPattern, file: opts.log.Name()}
+		}
+	case opts.logPattern != nil:
+		s.logs = &logWatcher{re: opts.logPattern}
+		cmd.Stdout, cmd.Stderr = io.MultiWriter(os.Stdout, s.logs), io.MultiWriter(os.Stderr, s.logs)
+	}
+	if opts.stdin {
+		cmd.Stdin = os.Stdin
+	}
+	fmt.Printf("   [$] %s\n", cmdStr)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	s.cmd = cmd
+	go func() {
+		s.err = cmd.Wait()
+		close(s.exited)
+	}()
+	return s, nil
+}
+
+// waitServices blocks until every service has exited and returns the first failure
+func waitServices(services []*service) error {
+	var first error
+	for _, s := range services {
+		<-s.exited
+		if s.err != nil && first == nil {
+			first = fmt.Errorf("run failed (%s): %w", s.env.Type, s.err)
+		}
+	}
+	return first
+}
+
+// envDir resolves the working directory of an environment inside the sandbox
+func envDir(root string, env metadata.EnvironmentConfig) (string, error) {
+	if env.Dir == "" {
+		return root, nil
+	}
+	clean := filepath.Clean(filepath.FromSlash(env.Dir))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("unsafe environment directory '%s'", env.Dir)
+	}
+	path := filepath.Join(root, clean)
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("environment directory '%s' not found in snapshot", env.Dir)
+	}
+	return path, nil
+}
+
+// checkRuntime verifies the tools an environment needs are installed.
+// Returns the name of the tool that was checked last (the missing one on failure).
+func checkRuntime(env metadata.EnvironmentConfig) (string, bool) {
 	var cmd *exec.Cmd
-	switch envType {
-	case "go":
+	switch {
+	case env.Type == "go":
 		cmd = exec.Command("go", "version")
-	case "node", "angular":
-		cmd = exec.Command("node", "-v")
-	case "python":
-		cmd = exec.Command("python", "--version")
-	case "rust":
+	case strings.HasPrefix(env.Type, "node") || env.Type == "angular":
+		// bun is a runtime of its own, bun projects don't need node
+		manager := strings.SplitN(env.PackageManager, "@", 2)[0]
+		if manager == "bun" {
+			return "bun", exec.Command("bun", "--version").Run() == nil
+		}
+		if exec.Command("node", "-v").Run() != nil {
+			return "node", false
+		}
+		// The package manager the lockfile belongs to (npm ships with node)
+		if manager == "" {
+			manager = "npm"
+		}
+		return manager, exec.Command(manager, "--version").Run() == nil
+	case env.Type == "python":
+		// conda brings its own interpreter, the other managers need one on PATH
+		manager := env.PackageManager
+		if manager != "conda" && exec.Command("python", "--version").Run() != nil {
+			return "python", false
+		}
+		if manager == "" || manager == "pip" {
+			return "python", true
+		}
+		return manager, exec.Command(manager, "--version").Run() == nil
+	case env.Type == "rust":
 		cmd = exec.Command("cargo", "--version")
-	case "java":
+	case env.Type == "java":
 		// Check for Maven as it's the primary tool we use
 		cmd = exec.Command("mvn", "-version")
-	case "php":
+	case env.Type == "php":
 		cmd = exec.Command("php", "-v")
+	case env.Type == "ruby":
+		cmd = exec.Command("bundle", "--version")
 	default:
-		return true // Unknown types assumed present or generic
+		return env.Type, true // Unknown types assumed present or generic
 	}
-	return cmd.Run() == nil
+	return cmd.Args[0], cmd.Run() == nil
 }
 
 func execute(dir, cmdStr string) error {
+	return executeWith(dir, cmdStr, nil)
+}
+
+// executeWith runs a command with extra environment (e.g. inside a virtualenv)
+func executeWith(dir, cmdStr string, xenv *execEnv) error {
 	parts := strings.Fields(cmdStr)
 	if len(parts) == 0 {
 		return nil
 	}
 
-	cmd := exec.Command(parts[0], parts[1:]...)
+	cmd := exec.Command(xenv.lookPath(parts[0]), parts[1:]...)
+	cmd.Env = xenv.environ()
 	cmd.Dir = dir
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -139,52 +377,47 @@ func execute(dir, cmdStr string) error {
 	return cmd.Run()
 }
 
-func installFromDevpack(dir, filename string, manualMode bool) error {
-	devpackPath := filepath.Join(dir, filename)
-	// Using generic unmarshal to map since we know the structure
-	content, err := ioutil.ReadFile(devpackPath)
+func installFromDevpack(dir, filename, snapshotName string, env metadata.EnvironmentConfig, manualMode bool, xenv *execEnv) error {
+	pack, err := devpack.ReadFile(filepath.Join(dir, filename))
 	if err != nil {
-		fmt.Printf("   ⚠️ Could not find %s\n", filename)
-		return nil
-	}
-
-	var pack struct {
-		Type         string            `json:"type"`
-		Dependencies map[string]string `json:"dependencies"`
-	}
-	if err := json.Unmarshal(content, &pack); err != nil {
-		return fmt.Errorf("failed to parse devpack: %w", err)
+		if os.IsNotExist(err) {
+			fmt.Printf("   ⚠️ Could not find %s\n", filename)
+			return nil
+		}
+		return err
 	}
 
-	// Branch based on type
-	if pack.Type == "go" {
-		return installGoDeps(dir, pack.Dependencies, manualMode)
-	} else if strings.HasPrefix(pack.Type, "node") || pack.Type == "angular" { // Handle "node (TypeScript)"
-		return installNodeDeps(dir, pack.Dependencies, manualMode)
-	} else if pack.Type == "python" {
-		return installPythonDeps(dir, pack.Dependencies, manualMode)
-	} else if pack.Type == "rust" || pack.Type == "java" || pack.Type == "php" {
-		fmt.Printf("   📦 %s dependencies are handled by the build tool (cargo/mvn/composer).\n", pack.Type)
-		return nil
+	switch pack.Ecosystem {
+	case devpack.Go:
+		// Sherlock Go snapshots have no go.mod, and go get needs one
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); os.IsNotExist(err) {
+			return initGoModule(dir, snapshotName, env.Version, pack, manualMode)
+		}
+		return installGoDeps(dir, pack, manualMode)
+	case devpack.Node:
+		return installNodeDeps(dir, pack, manualMode)
+	case devpack.Python:
+		return installPythonDeps(dir, pack, manualMode, xenv)
 	}
-
 	return nil
 }
 
-func installNodeDeps(dir string, deps map[string]string, manualMode bool) error {
+func installNodeDeps(dir string, pack *devpack.Devpack, manualMode bool) error {
 	// Construct installation command
 	args := []string{"install"}
-	for pkg, ver := range deps {
-		if ver == "latest" {
-			args = append(args, pkg)
-		} else {
-			args = append(args, fmt.Sprintf("%s@%s", pkg, ver))
+	for _, dep := range pack.Dependencies {
+		if dep.Registry != "" && dep.Registry != pack.Registry {
+			fmt.Printf("      ⚠️  %s comes from %s, configure it in .npmrc\n", dep.Name, dep.Registry)
 		}
+		args = append(args, dep.Name+"@"+dep.NodeSpec())
+	}
+	if pack.Registry != "" {
+		args = append(args, "--registry", pack.Registry)
 	}
 
 	cmdStr := fmt.Sprintf("npm %s", strings.Join(args, " "))
 	if manualMode {
-		if !promptUser(fmt.Sprintf("Install Node dependencies (%d packages)?\n   '%s'", len(deps), cmdStr)) {
+		if !promptUser(fmt.Sprintf("Install Node dependencies (%d packages)?\n   '%s'", len(pack.Dependencies), cmdStr)) {
 			fmt.Println("   ⏭️  Skipping dependency installation...")
 			return nil
 		}
@@ -199,20 +432,28 @@ func installNodeDeps(dir string, deps map[string]string, manualMode bool) error
 	return cmd.Run()
 }
 
-func installGoDeps(dir string, deps map[string]string, manualMode bool) error {
+func installGoDeps(dir string, pack *devpack.Devpack, manualMode bool) error {
 	fmt.Println("   📦 Installing Go dependencies...")
 
-	for pkg, ver := range deps {
-		target := pkg
-		if ver != "latest" && ver != "" {
-			target = fmt.Sprintf("%s@%s", pkg, ver)
-		} else {
-			target = pkg + "@latest"
+	for _, dep := range pack.Dependencies {
+		var target string
+		switch dep.SourceKind() {
+		case devpack.SourceLocal:
+			// go get can't fetch a directory, it has to be a replace
+			replace := fmt.Sprintf("go mod edit -replace %s=./%s", dep.Name, dep.Path)
+			if err := execute(dir, replace); err != nil {
+				return fmt.Errorf("failed to replace %s: %w", dep.Name, err)
+			}
+			continue
+		case devpack.SourceGit:
+			target = dep.Name + "@" + gitRef(dep)
+		default:
+			target = dep.Name + "@" + dep.Version
 		}
 
 		if manualMode {
 			if !promptUser(fmt.Sprintf("Install Go package: '%s'?", target)) {
-				fmt.Printf("   ⏭️  Skipping %s...\n", pkg)
+				fmt.Printf("   ⏭️  Skipping %s...\n", dep.Name)
 				continue
 			}
 		}
@@ -220,37 +461,88 @@ func installGoDeps(dir string, deps map[string]string, manualMode bool) error {
 		fmt.Printf("      -> go get %s\n", target)
 		cmd := exec.Command("go", "get", target)
 		cmd.Dir = dir
+		cmd.Env = (&execEnv{Vars: goProxyVars(pack)}).environ()
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to install %s: %w", pkg, err)
+			return fmt.Errorf("failed to install %s: %w", dep.Name, err)
+		}
+	}
+	return nil
+}
+
+// initGoModule writes a go.mod for a folder of .go files (module named after the snapshot,
+// go directive from the environment version, requires from the devpack) and lets
+// go mod tidy fill in go.sum and anything the devpack missed.
+func initGoModule(dir, snapshotName, goVersion string, pack *devpack.Devpack, manualMode bool) error {
+	module := devpack.GoModulePath(snapshotName)
+	if manualMode && !promptUser(fmt.Sprintf("Create go.mod for module '%s' (%d requirements)?", module, len(pack.Dependencies))) {
+		fmt.Println("   ⏭️  Skipping go.mod generation...")
+		return nil
+	}
+
+	content, queries := pack.GoMod(module, goVersion)
+	fmt.Printf("   📝 Generated go.mod (module %s)\n", module)
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), content, 0644); err != nil {
+		return fmt.Errorf("failed to write go.mod: %w", err)
+	}
+
+	xenv := &execEnv{Vars: goProxyVars(pack)}
+	// Unresolved versions are looked up now that there is a module to add them to
+	if len(queries) > 0 {
+		if err := executeWith(dir, "go get "+strings.Join(queries, " "), xenv); err != nil {
+			fmt.Printf("      ⚠️  go get failed: %v\n", err)
 		}
 	}
+
+	if err := executeWith(dir, "go mod tidy", xenv); err != nil {
+		fmt.Println("      ⚠️  go mod tidy failed, downloading the listed modules instead...")
+		return executeWith(dir, "go mod download", xenv)
+	}
 	return nil
 }
 
-func installPythonDeps(dir string, deps map[string]string, manualMode bool) error {
+// gitRef is the go get query for a git dependency (a branch, tag or commit; default branch if none)
+func gitRef(dep devpack.Dependency) string {
+	if dep.Ref == "" {
+		return "latest"
+	}
+	return dep.Ref
+}
+
+// goProxyVars points the go command at the devpack's registry (module proxy), if it has one
+func goProxyVars(pack *devpack.Devpack) []string {
+	if pack.Registry == "" {
+		return nil
+	}
+	return []string{"GOPROXY=" + pack.Registry + ",direct"}
+}
+
+func installPythonDeps(dir string, pack *devpack.Devpack, manualMode bool, xenv *execEnv) error {
 	// pip install pkg==ver pkg2==ver2
 	args := []string{"install"}
 
-	for pkg, ver := range deps {
-		if ver == "latest" || ver == "" {
-			args = append(args, pkg)
-		} else {
-			args = append(args, fmt.Sprintf("%s==%s", pkg, ver))
+	for _, dep := range pack.Dependencies {
+		args = append(args, dep.PipRequirement())
+		if dep.Registry != "" && dep.Registry != pack.Registry {
+			args = append(args, "--extra-index-url", dep.Registry)
 		}
 	}
+	if pack.Registry != "" {
+		args = append(args, "--index-url", pack.Registry)
+	}
 
 	cmdStr := fmt.Sprintf("pip %s", strings.Join(args, " "))
 	if manualMode {
-		if !promptUser(fmt.Sprintf("Install Python dependencies (%d packages)?\n   '%s'", len(deps), cmdStr)) {
+		if !promptUser(fmt.Sprintf("Install Python dependencies (%d packages)?\n   '%s'", len(pack.Dependencies), cmdStr)) {
 			fmt.Println("   ⏭️  Skipping dependency installation...")
 			return nil
 		}
 	}
 
 	fmt.Printf("   📦 Installing Python imports from devpack: %v\n", args[1:])
-	cmd := exec.Command("pip", args...)
+	cmd := exec.Command(xenv.lookPath("pip"), args...)
+	cmd.Env = xenv.environ()
 	cmd.Dir = dir
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -259,11 +551,23 @@ func installPythonDeps(dir string, deps map[string]string, manualMode bool) erro
 
 // promptUser asks for confirmation (Y/n)
 func promptUser(question string) bool {
-	fmt.Printf("\n[?] %s (Y/n): ", question)
+	return Confirm(question, true)
+}
+
+// Confirm asks a yes/no question; an empty answer picks def
+func Confirm(question string, def bool) bool {
+	hint := "Y/n"
+	if !def {
+		hint = "y/N"
+	}
+	fmt.Printf("\n[?] %s (%s): ", question, hint)
 	var response string
 	fmt.Scanln(&response) // Wait for enter
 	response = strings.ToLower(strings.TrimSpace(response))
-	return response == "" || response == "y" || response == "yes"
+	if response == "" {
+		return def
+	}
+	return response == "y" || response == "yes"
 }
 
 func loadEnvFile(dir string) {
@@ -298,8 +602,13 @@ func loadEnvFile(dir string) {
 	}
 }
 
-func ensureEnvTemplate(dir string, required []string) {
-	if len(required) == 0 {
+func ensureEnvTemplate(dir string, required []string, variables []metadata.VariableDefinition) {
+	// Every documented variable goes into the template, required or not
+	keys := append([]string(nil), required...)
+	for _, v := range variables {
+		keys = append(keys, v.Name)
+	}
+	if len(keys) == 0 {
 		return
 	}
 	envPath := filepath.Join(dir, ".env")
@@ -317,17 +626,44 @@ func ensureEnvTemplate(dir string, required []string) {
 	defer f.Close()
 
 	added := 0
-	for _, v := range required {
+	for _, v := range keys {
 		// Simple check if key exists in file
 		// Note: robust parsing is better, but this suffices for "adding missing keys"
-		if !strings.Contains(existing, v+"=") {
-			if _, err := f.WriteString(fmt.Sprintf("\n%s=", v)); err == nil {
-				added++
+		if strings.Contains(existing, v+"=") {
+			continue
+		}
+		line := fmt.Sprintf("\n%s=", v)
+		if def := findVariable(variables, v); def != nil {
+			if def.Description != "" {
+				line = fmt.Sprintf("\n# %s%s", def.Description, line)
 			}
+			line += def.Default
+		}
+		if _, err := f.WriteString(line); err == nil {
+			existing += line
+			added++
 		}
 	}
 
 	if added > 0 {
-		fmt.Printf("   📄 Added %d missing keys to .env (values are empty)\n", added)
+		fmt.Printf("   📄 Added %d missing keys to .env\n", added)
 	}
 }
+
+// applyVariableDefaults sets declared defaults for variables that are still unset
+func applyVariableDefaults(variables []metadata.VariableDefinition) {
+	for _, v := range variables {
+		if v.Default != "" && os.Getenv(v.Name) == "" {
+			os.Setenv(v.Name, v.Default)
+		}
+	}
+}
+
+func findVariable(variables []metadata.VariableDefinition, name string) *metadata.VariableDefinition {
+	for i := range variables {
+		if variables[i].Name == name {
+			return &variables[i]
+		}
+	}
+	return nil
+}
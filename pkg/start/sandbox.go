@@ -0,0 +1,435 @@
+package start
+
+import (
+	"crypto/sha256"
+	"devsnap/pkg/create"
+	"devsnap/pkg/metadata"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sandboxInfoFile records what a sandbox was unpacked from, inside the sandbox
+var sandboxInfoFile = filepath.Join(metadata.GeneratedDir, "sandbox.json")
+
+// ErrSandboxLocked is returned by LockSandbox while another devsnap uses the sandbox
+var ErrSandboxLocked = errors.New("sandbox is in use")
+
+// SandboxInfo describes a sandbox and the pristine state of the files unpacked into it
+type SandboxInfo struct {
+	Snapshot     string               `json:"snapshot"`      // Snapshot name
+	SnapshotPath string               `json:"snapshot_path"` // Absolute path of the .devsnap file
+	SnapshotID   string               `json:"snapshot_id"`   // See SnapshotID
+	Created      time.Time            `json:"created"`
+	LastUsed     time.Time            `json:"last_used"`
+	Files        map[string]FileStamp `json:"files"`           // Slash-separated path -> state at unpack
+	Steps        map[string]string    `json:"steps,omitempty"` // Completed setup steps -> hash of their inputs (see setupCache)
+}
+
+// FileStamp is the state of an unpacked file. Size and ModTime make checks cheap; SHA256 decides.
+type FileStamp struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	SHA256  string    `json:"sha256"`
+}
+
+// Change is a difference between a sandbox and the snapshot it was unpacked from
+type Change struct {
+	Path string // Slash-separated, relative to the sandbox
+	Kind string // "modified", "added" or "deleted"
+}
+
+// xdgDir returns $<envVar>/devsnap/<sub>, else ~/<unixDefault>/devsnap/<sub> (the user config dir on macOS and Windows)
+func xdgDir(envVar, unixDefault, sub string) (string, error) {
+	base := os.Getenv(envVar)
+	if base == "" {
+		if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+			dir, err := os.UserConfigDir()
+			if err != nil {
+				return "", err
+			}
+			return filepath.Join(dir, "devsnap", sub), nil
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, filepath.FromSlash(unixDefault))
+	}
+	return filepath.Join(base, "devsnap", sub), nil
+}
+
+// SandboxRoot is where sandboxes live unless --dir puts them elsewhere (~/.local/share/devsnap/sandboxes)
+func SandboxRoot() (string, error) {
+	return xdgDir("XDG_DATA_HOME", ".local/share", "sandboxes")
+}
+
+// externalDir remembers sandboxes created outside SandboxRoot with --dir, so list finds them
+func externalDir() (string, error) {
+	return xdgDir("XDG_DATA_HOME", ".local/share", "external")
+}
+
+// SandboxDir returns the sandbox of a snapshot: root/<name> for a named sandbox,
+// else root/<snapshot name>-<hash>, so each snapshot version gets its own.
+func SandboxDir(name, snapshotName, snapshotID string) (string, error) {
+	root, err := SandboxRoot()
+	if err != nil {
+		return "", err
+	}
+	if name != "" {
+		if name != filepath.Base(name) || name == "." || name == ".." {
+			return "", fmt.Errorf("sandbox name %q must not contain a path (use --dir)", name)
+		}
+		return filepath.Join(root, name), nil
+	}
+	slug := strings.Trim(regexp.MustCompile(`[^a-z0-9._-]+`).ReplaceAllString(strings.ToLower(snapshotName), "-"), "-.")
+	if slug == "" {
+		slug = "snapshot"
+	}
+	if len(snapshotID) > 12 {
+		snapshotID = snapshotID[:12]
+	}
+	return filepath.Join(root, slug+"-"+snapshotID), nil
+}
+
+// PrepareSandbox replaces the sandbox content with the snapshot and records its pristine state.
+// Virtualenvs are kept (see CleanSandbox) unless fresh, which starts from an empty directory.
+func PrepareSandbox(snapshotPath, dir, snapshotID string, fresh bool) (metadata.SnapshotMetadata, error) {
+	clean := CleanSandbox
+	if fresh {
+		clean = os.RemoveAll
+	}
+	if err := clean(dir); err != nil {
+		return metadata.SnapshotMetadata{}, fmt.Errorf("failed to clean sandbox: %w", err)
+	}
+
+	// Written before unpacking too: an interrupted unpack leaves a sandbox (with no snapshot) to redo
+	abs, _ := filepath.Abs(snapshotPath)
+	info := &SandboxInfo{SnapshotPath: abs, Created: time.Now(), LastUsed: time.Now()}
+	if err := info.save(dir); err != nil {
+		return metadata.SnapshotMetadata{}, err
+	}
+
+	meta, files, err := unpack(snapshotPath, dir)
+	if err != nil {
+		return meta, err
+	}
+	info.Snapshot, info.SnapshotID, info.Files = meta.Name, snapshotID, files
+	if err := info.save(dir); err != nil {
+		return meta, err
+	}
+	return meta, registerExternal(dir)
+}
+
+// ReadSandboxInfo reads the info of a sandbox (nil if dir isn't one)
+func ReadSandboxInfo(dir string) (*SandboxInfo, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dir, sandboxInfoFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var info SandboxInfo
+	if err := json.Unmarshal(content, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", sandboxInfoFile, err)
+	}
+	return &info, nil
+}
+
+func (info *SandboxInfo) save(dir string) error {
+	if err := os.MkdirAll(filepath.Join(dir, metadata.GeneratedDir), 0755); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, sandboxInfoFile), content, 0644)
+}
+
+// TouchSandbox records that the sandbox was used now
+func TouchSandbox(dir string) error {
+	info, err := ReadSandboxInfo(dir)
+	if err != nil || info == nil {
+		return err
+	}
+	info.LastUsed = time.Now()
+	return info.save(dir)
+}
+
+// SandboxChanges compares a sandbox with its pristine state. Dependencies and build
+// output (the directories create ignores, e.g. node_modules, .venv) don't count.
+func SandboxChanges(dir string) ([]Change, error) {
+	info, err := ReadSandboxInfo(dir)
+	if err != nil || info == nil {
+		return nil, err
+	}
+
+	var changes []Change
+	seen := make(map[string]bool)
+	err = filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		if create.DefaultIgnores[fi.Name()] {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() || !fi.Mode().IsRegular() {
+			return nil
+		}
+
+		stamp, tracked := info.Files[rel]
+		seen[rel] = true
+		switch {
+		case !tracked:
+			changes = append(changes, Change{rel, "added"})
+		case fi.Size() != stamp.Size:
+			changes = append(changes, Change{rel, "modified"})
+		case !fi.ModTime().Equal(stamp.ModTime):
+			if sum, err := hashFile(path); err != nil || sum != stamp.SHA256 {
+				changes = append(changes, Change{rel, "modified"})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for rel := range info.Files {
+		if !seen[rel] && !ignoredPath(rel) {
+			changes = append(changes, Change{rel, "deleted"})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// ignoredPath reports whether any element of a slash-separated path is ignored by create
+func ignoredPath(rel string) bool {
+	for _, part := range strings.Split(rel, "/") {
+		if create.DefaultIgnores[part] {
+			return true
+		}
+	}
+	return false
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// LockSandbox makes sure only one devsnap uses a sandbox at a time.
+// A lock left by a process that no longer exists is taken over. Call release when done.
+func LockSandbox(dir string) (release func(), err error) {
+	lock, err := lockFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(lock), 0755); err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if pid := lockHolder(lock); pid > 0 && processAlive(pid) {
+			return nil, fmt.Errorf("%w by devsnap (pid %d)", ErrSandboxLocked, pid)
+		}
+		os.Remove(lock) // Stale
+	}
+	return nil, ErrSandboxLocked
+}
+
+// SandboxLocked reports whether another devsnap holds the sandbox lock
+func SandboxLocked(dir string) bool {
+	lock, err := lockFile(dir)
+	if err != nil {
+		return false
+	}
+	pid := lockHolder(lock)
+	return pid > 0 && processAlive(pid)
+}
+
+// lockFile lives outside the sandbox so cleaning the sandbox can't remove it
+func lockFile(dir string) (string, error) {
+	locks, err := xdgDir("XDG_DATA_HOME", ".local/share", "locks")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(locks, pathKey(dir)+".lock"), nil
+}
+
+func lockHolder(lock string) int {
+	content, err := ioutil.ReadFile(lock)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(content)))
+	return pid
+}
+
+// pathKey names per-sandbox files (locks, pointers) after the absolute sandbox path
+func pathKey(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return hex.EncodeToString(sum[:8])
+}
+
+// registerExternal remembers a sandbox outside SandboxRoot
+func registerExternal(dir string) error {
+	root, err := SandboxRoot()
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if filepath.Dir(abs) == filepath.Clean(root) {
+		return nil
+	}
+	ext, err := externalDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(ext, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(ext, pathKey(abs)), []byte(abs), 0644)
+}
+
+// SandboxEntry is one sandbox found by ListSandboxes
+type SandboxEntry struct {
+	Dir  string
+	Info *SandboxInfo
+}
+
+// Managed reports whether the sandbox lives in SandboxRoot (rather than a --dir of the user's choosing)
+func (e SandboxEntry) Managed() bool {
+	root, err := SandboxRoot()
+	return err == nil && filepath.Dir(e.Dir) == filepath.Clean(root)
+}
+
+// Name is how sandbox rm refers to the sandbox: its directory name under SandboxRoot, else its path
+func (e SandboxEntry) Name() string {
+	if e.Managed() {
+		return filepath.Base(e.Dir)
+	}
+	return e.Dir
+}
+
+// ListSandboxes returns every known sandbox, forgetting external ones that were deleted
+func ListSandboxes() ([]SandboxEntry, error) {
+	var entries []SandboxEntry
+	root, err := SandboxRoot()
+	if err != nil {
+		return nil, err
+	}
+	dirs, _ := ioutil.ReadDir(root)
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, d.Name())
+		if info, err := ReadSandboxInfo(dir); err == nil && info != nil {
+			entries = append(entries, SandboxEntry{dir, info})
+		}
+	}
+
+	ext, err := externalDir()
+	if err != nil {
+		return nil, err
+	}
+	pointers, _ := ioutil.ReadDir(ext)
+	for _, p := range pointers {
+		content, err := ioutil.ReadFile(filepath.Join(ext, p.Name()))
+		if err != nil {
+			continue
+		}
+		dir := string(content)
+		info, err := ReadSandboxInfo(dir)
+		if err != nil || info == nil {
+			os.Remove(filepath.Join(ext, p.Name()))
+			continue
+		}
+		entries = append(entries, SandboxEntry{dir, info})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Dir < entries[j].Dir })
+	return entries, nil
+}
+
+// FindSandbox resolves a sandbox by name (see SandboxEntry.Name) or path
+func FindSandbox(nameOrPath string) (*SandboxEntry, error) {
+	entries, err := ListSandboxes()
+	if err != nil {
+		return nil, err
+	}
+	abs, _ := filepath.Abs(nameOrPath)
+	for _, e := range entries {
+		if e.Name() == nameOrPath || e.Dir == abs || e.Dir == nameOrPath {
+			return &e, nil
+		}
+	}
+	return nil, fmt.Errorf("no sandbox '%s' (see 'devsnap sandbox list')", nameOrPath)
+}
+
+// RemoveSandbox deletes a sandbox that is neither locked nor running services
+func RemoveSandbox(dir string) error {
+	if SandboxLocked(dir) {
+		return ErrSandboxLocked
+	}
+	if HasRunning(dir) {
+		return fmt.Errorf("services are still running in %s (run 'devsnap stop --sandbox %s')", dir, dir)
+	}
+	if info, err := ReadSandboxInfo(dir); err != nil || info == nil {
+		// Never delete a directory we didn't create
+		return fmt.Errorf("%s is not a devsnap sandbox", dir)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if ext, err := externalDir(); err == nil {
+		os.Remove(filepath.Join(ext, pathKey(dir)))
+	}
+	return nil
+}
@@ -3,7 +3,9 @@ package start
 import (
 	"archive/tar"
 	"compress/gzip"
+	"crypto/sha256"
 	"devsnap/pkg/metadata"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -16,21 +18,29 @@ import (
 // Unpack opens the snapshot and extracts it to the destDir.
 // Returns the meta and any error.
 func Unpack(snapshotPath, destDir string) (metadata.SnapshotMetadata, error) {
+	meta, _, err := unpack(snapshotPath, destDir)
+	return meta, err
+}
+
+// unpack extracts the snapshot and also returns the state of every extracted file,
+// which SandboxChanges compares against later.
+func unpack(snapshotPath, destDir string) (metadata.SnapshotMetadata, map[string]FileStamp, error) {
 	var meta metadata.SnapshotMetadata
+	files := make(map[string]FileStamp)
 
 	if err := os.MkdirAll(destDir, 0755); err != nil {
-		return meta, fmt.Errorf("failed to create dest dir: %w", err)
+		return meta, nil, fmt.Errorf("failed to create dest dir: %w", err)
 	}
 
 	file, err := os.Open(snapshotPath)
 	if err != nil {
-		return meta, fmt.Errorf("failed to open snapshot: %w", err)
+		return meta, nil, fmt.Errorf("failed to open snapshot: %w", err)
 	}
 	defer file.Close()
 
 	gr, err := gzip.NewReader(file)
 	if err != nil {
-		return meta, fmt.Errorf("failed to create gzip reader: %w", err)
+		return meta, nil, fmt.Errorf("failed to create gzip reader: %w", err)
 	}
 	defer gr.Close()
 
@@ -46,7 +56,7 @@ func Unpack(snapshotPath, destDir string) (metadata.SnapshotMetadata, error) {
 			break
 		}
 		if err != nil {
-			return meta, fmt.Errorf("tar reading error: %w", err)
+			return meta, nil, fmt.Errorf("tar reading error: %w", err)
 		}
 
 		// Sanitize header name to prevent ZipSlip
@@ -63,24 +73,28 @@ func Unpack(snapshotPath, destDir string) (metadata.SnapshotMetadata, error) {
 		switch header.Typeflag {
 		case tar.TypeDir:
 			if err := os.MkdirAll(target, 0755); err != nil {
-				return meta, err
+				return meta, nil, err
 			}
 		case tar.TypeReg:
 			// Ensure parent dir exists
 			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
-				return meta, err
+				return meta, nil, err
 			}
 
 			// Extract file
 			outFile, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR, os.FileMode(header.Mode))
 			if err != nil {
-				return meta, err
+				return meta, nil, err
 			}
-			if _, err := io.Copy(outFile, tr); err != nil {
+			h := sha256.New()
+			if _, err := io.Copy(io.MultiWriter(outFile, h), tr); err != nil {
 				outFile.Close()
-				return meta, err
+				return meta, nil, err
 			}
 			outFile.Close()
+			if fi, err := os.Stat(target); err == nil {
+				files[filepath.ToSlash(cleanName)] = FileStamp{Size: fi.Size(), ModTime: fi.ModTime(), SHA256: hex.EncodeToString(h.Sum(nil))}
+			}
 
 			// If this is the metadata file, read it immediately
 			if filepath.Base(header.Name) == metaFileName && !metaFound {
@@ -95,8 +109,42 @@ func Unpack(snapshotPath, destDir string) (metadata.SnapshotMetadata, error) {
 	}
 
 	if !metaFound {
-		return meta, fmt.Errorf("invalid snapshot: metadata.json not found")
+		return meta, nil, fmt.Errorf("invalid snapshot: metadata.json not found")
 	}
 
-	return meta, nil
+	return meta, files, nil
+}
+
+// ReadMetadata reads a snapshot's metadata without extracting it
+func ReadMetadata(snapshotPath string) (metadata.SnapshotMetadata, error) {
+	var meta metadata.SnapshotMetadata
+
+	file, err := os.Open(snapshotPath)
+	if err != nil {
+		return meta, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer file.Close()
+
+	gr, err := gzip.NewReader(file)
+	if err != nil {
+		return meta, fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return meta, fmt.Errorf("invalid snapshot: metadata.json not found")
+		}
+		if err != nil {
+			return meta, fmt.Errorf("tar reading error: %w", err)
+		}
+		if filepath.Clean(header.Name) == "metadata.json" {
+			if err := json.NewDecoder(tr).Decode(&meta); err != nil {
+				return meta, fmt.Errorf("invalid metadata.json: %w", err)
+			}
+			return meta, nil
+		}
+	}
 }
@@ -0,0 +1,237 @@
+package start
+
+import (
+	"crypto/sha256"
+	"devsnap/pkg/metadata"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// venvDir is the virtualenv created next to each python environment in the sandbox
+const venvDir = ".venv"
+
+// venvMarker records which snapshot a virtualenv was built for
+const venvMarker = "devsnap-snapshot"
+
+// execEnv carries extra environment for commands, e.g. an activated virtualenv
+type execEnv struct {
+	Path []string // Directories searched first and prepended to PATH
+	Vars []string // KEY=VALUE pairs
+}
+
+// environ returns the process environment with e applied
+func (e *execEnv) environ() []string {
+	env := os.Environ()
+	if e == nil {
+		return env
+	}
+	if len(e.Path) > 0 {
+		path := strings.Join(e.Path, string(os.PathListSeparator)) + string(os.PathListSeparator) + os.Getenv("PATH")
+		env = setEnv(env, "PATH", path)
+	}
+	for _, kv := range e.Vars {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 {
+			env = setEnv(env, parts[0], parts[1])
+		}
+	}
+	return env
+}
+
+// with returns a copy of e with extra KEY=VALUE pairs (e may be nil)
+func (e *execEnv) with(vars ...string) *execEnv {
+	if len(vars) == 0 {
+		return e
+	}
+	out := &execEnv{}
+	if e != nil {
+		out.Path = e.Path
+		out.Vars = append(out.Vars, e.Vars...)
+	}
+	out.Vars = append(out.Vars, vars...)
+	return out
+}
+
+// lookPath resolves a command in e.Path before falling back to the process PATH
+func (e *execEnv) lookPath(name string) string {
+	if e == nil || strings.ContainsAny(name, `/\`) {
+		return name
+	}
+	for _, dir := range e.Path {
+		for _, candidate := range executableNames(name) {
+			p := filepath.Join(dir, candidate)
+			if info, err := os.Stat(p); err == nil && !info.IsDir() {
+				return p
+			}
+		}
+	}
+	return name
+}
+
+// SnapshotID returns a content hash that identifies a snapshot file
+func SnapshotID(snapshotPath string) (string, error) {
+	f, err := os.Open(snapshotPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// CleanSandbox removes a previous sandbox but keeps its virtualenvs,
+// which pythonExecEnv reuses when they were built for the same snapshot.
+func CleanSandbox(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if !entry.IsDir() {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			continue
+		}
+		if entry.Name() == venvDir {
+			continue
+		}
+		if err := CleanSandbox(path); err != nil {
+			return err
+		}
+		// Fails (on purpose) if a kept virtualenv lives below
+		os.Remove(path)
+	}
+	return nil
+}
+
+// pythonExecEnv prepares the isolated environment a python environment runs in.
+// pip-managed projects get a .venv in their directory; poetry and pipenv are told
+// to keep theirs in the project too, so nothing is installed into the host.
+// Their .venv is dropped if another snapshot built it (see markVenv).
+func pythonExecEnv(workDir string, env metadata.EnvironmentConfig, snapshotID string) (*execEnv, error) {
+	switch env.PackageManager {
+	case "conda", "uv":
+		// conda envs are named and global by design; uv already uses ./.venv
+		return nil, nil
+	case "poetry":
+		if err := dropStaleVenv(workDir, snapshotID); err != nil {
+			return nil, err
+		}
+		return &execEnv{Vars: []string{"POETRY_VIRTUALENVS_IN_PROJECT=true"}}, nil
+	case "pipenv":
+		if err := dropStaleVenv(workDir, snapshotID); err != nil {
+			return nil, err
+		}
+		return &execEnv{Vars: []string{"PIPENV_VENV_IN_PROJECT=1"}}, nil
+	}
+
+	venv, err := ensureVenv(workDir, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	return &execEnv{
+		Path: []string{venvBinDir(venv)},
+		Vars: []string{"VIRTUAL_ENV=" + venv, "PIP_REQUIRE_VIRTUALENV=true"},
+	}, nil
+}
+
+// ensureVenv creates workDir/.venv, or reuses it if it was built for the same snapshot
+func ensureVenv(workDir, snapshotID string) (string, error) {
+	// Absolute, commands run with their own working directory
+	abs, err := filepath.Abs(workDir)
+	if err != nil {
+		return "", err
+	}
+	venv := filepath.Join(abs, venvDir)
+
+	if _, err := os.Stat(filepath.Join(venvBinDir(venv), executableNames("python")[0])); err == nil {
+		if venvBuiltFor(venv, snapshotID) {
+			fmt.Printf("   ♻️  Reusing virtualenv %s\n", venvDir)
+			return venv, nil
+		}
+		fmt.Println("   🧹 Virtualenv belongs to another snapshot, recreating...")
+		if err := os.RemoveAll(venv); err != nil {
+			return "", err
+		}
+	}
+
+	fmt.Printf("   🐍 Creating virtualenv %s\n", venvDir)
+	cmd := exec.Command("python", "-m", "venv", venvDir)
+	cmd.Dir = workDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to create virtualenv: %w", err)
+	}
+	markVenv(workDir, snapshotID)
+	return venv, nil
+}
+
+// dropStaleVenv removes the workDir/.venv poetry or pipenv created, unless it was built for the same snapshot
+func dropStaleVenv(workDir, snapshotID string) error {
+	venv := filepath.Join(workDir, venvDir)
+	if _, err := os.Stat(venv); err != nil {
+		return nil
+	}
+	if venvBuiltFor(venv, snapshotID) {
+		fmt.Printf("   ♻️  Reusing virtualenv %s\n", venvDir)
+		return nil
+	}
+	fmt.Println("   🧹 Virtualenv belongs to another snapshot, removing it...")
+	return os.RemoveAll(venv)
+}
+
+// markVenv records which snapshot the virtualenv in workDir (if there is one) was built for
+func markVenv(workDir, snapshotID string) {
+	venv := filepath.Join(workDir, venvDir)
+	if info, err := os.Stat(venv); err == nil && info.IsDir() && snapshotID != "" {
+		ioutil.WriteFile(filepath.Join(venv, venvMarker), []byte(snapshotID), 0644)
+	}
+}
+
+func venvBuiltFor(venv, snapshotID string) bool {
+	recorded, err := ioutil.ReadFile(filepath.Join(venv, venvMarker))
+	return err == nil && snapshotID != "" && string(recorded) == snapshotID
+}
+
+func venvBinDir(venv string) string {
+	if runtime.GOOS == "windows" {
+		return filepath.Join(venv, "Scripts")
+	}
+	return filepath.Join(venv, "bin")
+}
+
+func executableNames(name string) []string {
+	if runtime.GOOS == "windows" {
+		return []string{name + ".exe", name + ".cmd", name + ".bat", name}
+	}
+	return []string{name}
+}
+
+// setEnv replaces or appends KEY=VALUE in an environment list
+func setEnv(env []string, key, value string) []string {
+	prefix := key + "="
+	for i, kv := range env {
+		if strings.HasPrefix(kv, prefix) || (runtime.GOOS == "windows" && strings.HasPrefix(strings.ToUpper(kv), strings.ToUpper(prefix))) {
+			env[i] = prefix + value
+			return env
+		}
+	}
+	return append(env, prefix+value)
+}
@@ -0,0 +1,160 @@
+package start
+
+import (
+	"crypto/sha256"
+	"devsnap/pkg/metadata"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// setupInputs are the files a setup command installs from. A step is redone when one changes.
+var setupInputs = []string{
+	"package.json", "package-lock.json", "npm-shrinkwrap.json", "yarn.lock", "pnpm-lock.yaml", "bun.lockb", "bun.lock", ".npmrc",
+	"requirements.txt", "pyproject.toml", "poetry.lock", "Pipfile", "Pipfile.lock", "uv.lock", "environment.yml",
+	"go.mod", "go.sum",
+	"Gemfile", "Gemfile.lock",
+	"composer.json", "composer.lock",
+	"pom.xml", "build.gradle", "build.gradle.kts",
+	"Cargo.toml", "Cargo.lock",
+}
+
+// setupOutputs are where installs land inside the sandbox. A step whose output was deleted is redone.
+var setupOutputs = map[string]string{
+	"package.json":  "node_modules",
+	"composer.json": "vendor",
+}
+
+// setupCache remembers the setup steps completed in a sandbox (in its SandboxInfo),
+// so starting the same snapshot again only redoes the steps whose inputs changed.
+type setupCache struct {
+	dir  string
+	info *SandboxInfo // nil when dir isn't a sandbox: nothing is cached
+}
+
+func loadSetupCache(dir string) *setupCache {
+	info, err := ReadSandboxInfo(dir)
+	if err != nil {
+		fmt.Printf("   ⚠️  Ignoring setup cache: %v\n", err)
+		info = nil
+	}
+	return &setupCache{dir: dir, info: info}
+}
+
+// stepKey names a setup step: the environment it belongs to and its command
+func stepKey(env metadata.EnvironmentConfig, cmdStr string) string {
+	return envName(env) + ": " + cmdStr
+}
+
+// stepHash hashes what a step depends on: its command, the devpack it installs, the
+// manifests and lockfiles of its directory and where it installs to. "" means the step
+// can't be cached.
+func (c *setupCache) stepHash(workDir string, env metadata.EnvironmentConfig, cmdStr string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00", env.Type, env.Version, cmdStr)
+
+	inputs := make([]string, 0, len(setupInputs)+1)
+	if strings.HasPrefix(cmdStr, "#DEVPACK") {
+		filename := "dependencies.devpack"
+		if strings.HasPrefix(cmdStr, "#DEVPACK:") {
+			filename = strings.TrimPrefix(cmdStr, "#DEVPACK:")
+		}
+		inputs = append(inputs, filepath.Join(c.dir, filename))
+	}
+	for _, name := range setupInputs {
+		inputs = append(inputs, filepath.Join(workDir, name))
+	}
+
+	for _, path := range inputs {
+		content, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return ""
+		}
+		sum := sha256.Sum256(content)
+		fmt.Fprintf(h, "%s\x00%x\x00", filepath.Base(path), sum)
+
+		// Deleting what was installed (rm -rf node_modules) redoes the step
+		if out, ok := setupOutputs[filepath.Base(path)]; ok {
+			_, err := os.Stat(filepath.Join(workDir, out))
+			fmt.Fprintf(h, "%s\x00%t\x00", out, err == nil)
+		}
+	}
+
+	// Python installs land in the virtualenv: one that was deleted or recreated
+	// (it gets a new pyvenv.cfg) is empty again, so the step is redone
+	if env.Type == "python" {
+		created := "none"
+		if fi, err := os.Stat(filepath.Join(workDir, venvDir, "pyvenv.cfg")); err == nil {
+			created = fi.ModTime().UTC().Format(time.RFC3339Nano)
+		}
+		fmt.Fprintf(h, "%s\x00%s\x00", venvDir, created)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// untouched returns the inputs of workDir the user hasn't edited since unpack (or that
+// don't exist yet), as sandbox paths. What a step writes to them is not a user change.
+func (c *setupCache) untouched(workDir string) []string {
+	if c.info == nil {
+		return nil
+	}
+	var paths []string
+	for _, name := range setupInputs {
+		path := filepath.Join(workDir, name)
+		rel, err := filepath.Rel(c.dir, path)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		fi, err := os.Stat(path)
+		stamp, tracked := c.info.Files[rel]
+		switch {
+		case os.IsNotExist(err):
+			paths = append(paths, rel)
+		case err == nil && tracked && fi.Size() == stamp.Size:
+			if sum, err := hashFile(path); err == nil && sum == stamp.SHA256 {
+				paths = append(paths, rel)
+			}
+		}
+	}
+	return paths
+}
+
+// done reports whether the step already ran with the same inputs
+func (c *setupCache) done(key, hash string) bool {
+	return c.info != nil && hash != "" && c.info.Steps[key] == hash
+}
+
+// record marks a step as completed, and what it wrote to the untouched inputs as pristine
+func (c *setupCache) record(key, hash string, untouched []string) {
+	if c.info == nil || hash == "" {
+		return
+	}
+	if c.info.Steps == nil {
+		c.info.Steps = make(map[string]string)
+	}
+	c.info.Steps[key] = hash
+	if c.info.Files == nil {
+		c.info.Files = make(map[string]FileStamp)
+	}
+	for _, rel := range untouched {
+		path := filepath.Join(c.dir, filepath.FromSlash(rel))
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if sum, err := hashFile(path); err == nil {
+			c.info.Files[rel] = FileStamp{Size: fi.Size(), ModTime: fi.ModTime(), SHA256: sum}
+		}
+	}
+	if err := c.info.save(c.dir); err != nil {
+		fmt.Printf("      ⚠️  Failed to save setup cache: %v\n", err)
+	}
+}